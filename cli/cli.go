@@ -1,9 +1,11 @@
 package cli
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/jandre/passward/commands"
+	"github.com/jandre/passward/passward"
 	kingpin "gopkg.in/alecthomas/kingpin.v1"
 )
 
@@ -13,7 +15,17 @@ const NAME = "passward"
 var (
 	app   = kingpin.New("passward", "Securely store and share passwords.")
 	debug = app.Flag("debug", "Enable debug mode.").Bool()
-	setup = app.Command("setup", "Setup passward environment.")
+	setup = app.Command("setup", fmt.Sprintf("Setup passward environment. With any flag but --home, setup doesn't prompt, and exits with "+
+		"%d for missing or conflicting flags, %d if passward is already set up, %d if the keys can't be used "+
+		"and %d if the config can't be saved.", commands.SetupExitInvalidArgs, commands.SetupExitExists,
+		commands.SetupExitInvalidKeys, commands.SetupExitConfigFailed))
+
+	setupEmail         = setup.Flag("email", "Email address, setup won't prompt if given.").String()
+	setupName          = setup.Flag("name", "Name, defaults to the email address.").String()
+	setupPublicKey     = setup.Flag("public-key", "Path to the public key. Generates a keypair if no keys are given.").String()
+	setupPrivateKey    = setup.Flag("private-key", "Path to the private key.").String()
+	setupPassphraseEnv = setup.Flag("passphrase-env", "Environment variable holding the private key passphrase.").String()
+	setupHome          = setup.Flag("home", "Directory to install passward in, instead of $PASSWARD_HOME.").String()
 
 	// vault new
 	vault         = app.Command("vault", "Create and manage vaults.")
@@ -25,6 +37,8 @@ var (
 	vaultUse      = vault.Command("use", "Select active vault.")
 	vaultUseName  = vaultUse.Arg("name", "Name of the vault to use").Required().String()
 
+	vaultNewEncryptNames = vaultNew.Flag("encrypt-names", "Hide site names in an encrypted index.").Bool()
+
 	vaultAdd              = vault.Command("add", "")
 	vaultAddUser          = vaultAdd.Command("user", "Add a user to the vault")
 	vaultAddUserEmail     = vaultAddUser.Arg("email", "Email address, e.g. bob@foo.com").Required().String()
@@ -44,15 +58,109 @@ var (
 	addSecretName        = addSecret.Flag("vault", "Name of the vault.").String()
 	addSecretSite        = addSecret.Flag("site", "The site is the container for the secrets.").Required().String()
 	addSecretUsername    = addSecret.Flag("username", "Username associated with the site.").Required().String()
-	addSecretPassword    = addSecret.Flag("passphrase", "Passphrase to store with the site.").Required().String()
+	addSecretPassword    = addSecret.Flag("passphrase", "Passphrase to store with the site (prompted for if left out).").String()
 	addSecretDescription = addSecret.Flag("description", "Description to store with the site.").String()
+	addSecretFields      = addSecret.Flag("field", "Extra key=value field to store with the site (repeatable).").Strings()
+	addSecretFieldFiles  = addSecret.Flag("field-file", "Extra key=path field, read from the file at path (repeatable).").Strings()
+
+	addSecretPasswordStdin = addSecret.Flag("passphrase-stdin", "Read the passphrase to store from stdin.").Bool()
+	addSecretPasswordFile  = addSecret.Flag("passphrase-file", "Read the passphrase to store from a file.").String()
+
+	addSecretGenerate         = addSecret.Flag("generate", "Generate the passphrase instead of passing --passphrase.").Bool()
+	addSecretLength           = addSecret.Flag("length", "Length of the generated passphrase.").Default("20").Int()
+	addSecretClasses          = addSecret.Flag("classes", "Character classes of the generated passphrase.").Default("lower,upper,digits,symbols").String()
+	addSecretExcludeAmbiguous = addSecret.Flag("exclude-ambiguous", "Leave out look-alike characters such as l, 1, O and 0.").Bool()
+	addSecretWords            = addSecret.Flag("words", fmt.Sprintf("Generate a passphrase of this many words instead (diceware style, at least %d with the built-in list).", passward.MinPassphraseWords(nil))).Int()
+	addSecretWordlist         = addSecret.Flag("wordlist", fmt.Sprintf("File with one word per line to use with --words, which must then give at least %d bits of entropy.", passward.MinPassphraseBits)).String()
+	addSecretShow             = addSecret.Flag("show", "Print the generated passphrase.").Bool()
+
+	field               = app.Command("field", "Set or remove fields of a site.")
+	fieldSet            = field.Command("set", "Set one or more fields of a site.")
+	fieldSetVaultName   = fieldSet.Flag("vault", "Name of the vault.").String()
+	fieldSetSite        = fieldSet.Flag("site", "Name of the site.").Required().String()
+	fieldSetFiles       = fieldSet.Flag("field-file", "key=path field, read from the file at path (repeatable).").Strings()
+	fieldSetValues      = fieldSet.Arg("fields", "key=value fields to set.").Strings()
+	fieldUnset          = field.Command("unset", "Remove one or more fields of a site.")
+	fieldUnsetVaultName = fieldUnset.Flag("vault", "Name of the vault.").String()
+	fieldUnsetSite      = fieldUnset.Flag("site", "Name of the site.").Required().String()
+	fieldUnsetKeys      = fieldUnset.Arg("keys", "Names of the fields to remove.").Required().Strings()
 
 	revealSecret          = app.Command("reveal", "Reveal a secret.")
-	revealSecretSite      = revealSecret.Arg("site", "Name of site to reveal.").Required().String()
+	revealSecretSite      = revealSecret.Arg("site", "Name of site to reveal.").String()
+	revealSecretSiteFlag  = revealSecret.Flag("site", "Name of site to reveal.").String()
 	revealSecretVaultName = revealSecret.Flag("vault", "Name of the vault.").String()
+	revealSecretHistory   = revealSecret.Flag("history", "Also list earlier values, newest first.").Bool()
+
+	editSecret            = app.Command("edit", "Change some fields of a site, or edit it in $EDITOR if none are given.")
+	editSecretName        = editSecret.Flag("vault", "Name of the vault.").String()
+	editSecretSite        = editSecret.Flag("site", "Name of the site.").Required().String()
+	editSecretUsername    = editSecret.Flag("username", "New username.").String()
+	editSecretPassword    = editSecret.Flag("passphrase", "New passphrase.").String()
+	editSecretDescription = editSecret.Flag("description", "New description.").String()
+	editSecretFields      = editSecret.Flag("field", "key=value field to change (repeatable).").Strings()
+	editSecretFieldFiles  = editSecret.Flag("field-file", "key=path field, read from the file at path (repeatable).").Strings()
+
+	agent            = app.Command("agent", "Keep your keys unlocked in memory for other commands.")
+	agentIdleTimeout = agent.Flag("idle-timeout", "Lock the keys after this long without use (0 to never).").Default("15m").Duration()
+
+	lock = app.Command("lock", "Make a running agent forget your keys.")
+
+	search          = app.Command("search", "Search sites by name across vaults.")
+	searchPattern   = search.Arg("pattern", "Glob, e.g. com.*, or a regular expression with --regex.").Required().String()
+	searchVaultName = search.Flag("vault", "Only search this vault.").String()
+	searchRegex     = search.Flag("regex", "Treat the pattern as a regular expression.").Bool()
+	searchFields    = search.Flag("fields", "Also search the decrypted username and description.").Bool()
+
+	otp          = app.Command("otp", "Print the current one-time password of a site with a totp field.")
+	otpVaultName = otp.Flag("vault", "Name of the vault.").String()
+	otpSite      = otp.Flag("site", "Name of the site.").Required().String()
+
+	attach          = app.Command("attach", "Attach a file to a site.")
+	attachVaultName = attach.Flag("vault", "Name of the vault.").String()
+	attachSite      = attach.Flag("site", "Name of the site.").Required().String()
+	attachFile      = attach.Flag("file", "Path of the file to attach.").Required().String()
+	attachName      = attach.Flag("name", "Name of the attachment (defaults to the file name).").String()
+
+	extract          = app.Command("extract", "Extract a file attached to a site.")
+	extractVaultName = extract.Flag("vault", "Name of the vault.").String()
+	extractSite      = extract.Flag("site", "Name of the site.").Required().String()
+	extractName      = extract.Flag("name", "Name of the attachment.").Required().String()
+	extractOut       = extract.Flag("out", "Path to write the file to, or - for stdout.").Required().String()
+
+	removeSecret          = app.Command("remove", "Remove a site.")
+	removeSecretSite      = removeSecret.Flag("site", "Name of the site to remove.").Required().String()
+	removeSecretVaultName = removeSecret.Flag("vault", "Name of the vault.").String()
+
+	renameSecret          = app.Command("rename", "Rename a site.")
+	renameSecretSite      = renameSecret.Flag("site", "Name of the site to rename.").Required().String()
+	renameSecretTo        = renameSecret.Flag("to", "New name of the site.").Required().String()
+	renameSecretVaultName = renameSecret.Flag("vault", "Name of the vault.").String()
+
+	restore          = app.Command("restore", "Restore a site, or the whole vault, to an earlier revision.")
+	restoreVaultName = restore.Flag("vault", "Name of the vault.").String()
+	restoreSite      = restore.Flag("site", "Name of the site to restore.").String()
+	restoreAt        = restore.Flag("at", "Commit id, date (2006-01-02) or duration ago (72h) to restore from.").Required().String()
+	restoreVaultWide = restore.Flag("vault-wide", "Restore every site in the vault.").Bool()
+
+	vaultSync      = vault.Command("sync", "Sync local vault with a remote vault.")
+	vaultSyncName  = vaultSync.Flag("vault", "(optional) Name of the vault to sync.").String()
+	vaultSyncAbort = vaultSync.Flag("abort", "Throw away a merge left unfinished by an earlier sync.").Bool()
+
+	vaultEnrollAgent     = vault.Command("enroll-agent", "Unlock the vault through ssh-agent from now on.")
+	vaultEnrollAgentName = vaultEnrollAgent.Flag("vault", "(optional) Name of the vault to enroll.").String()
+
+	vaultRotateKey     = vault.Command("rotate-key", "Replace the vault master key and re-encrypt all secrets.")
+	vaultRotateKeyName = vaultRotateKey.Flag("vault", "(optional) Name of the vault to rotate.").String()
 
-	vaultSync     = vault.Command("sync", "Sync local vault with a remote vault.")
-	vaultSyncName = vaultSync.Flag("vault", "(optional) Name of the vault to sync.").String()
+	vaultUpgrade     = vault.Command("upgrade", "Re-encrypt secrets stored in an older format, and reject that format from then on.")
+	vaultUpgradeName = vaultUpgrade.Flag("vault", "(optional) Name of the vault to upgrade.").String()
+
+	vaultLog      = vault.Command("log", "Show who changed the entries and users of a vault.")
+	vaultLogName  = vaultLog.Flag("vault", "(optional) Name of the vault.").String()
+	vaultLogSite  = vaultLog.Flag("site", "(optional) Only show changes to this site.").String()
+	vaultLogUser  = vaultLog.Flag("user", "(optional) Only show changes by or to this user email.").String()
+	vaultLogSince = vaultLog.Flag("since", "(optional) Only show changes since a date (2006-01-02) or duration (72h).").String()
+	vaultLogJson  = vaultLog.Flag("json", "Print one JSON event per line.").Bool()
 
 	vaultFetch     = vault.Command("fetch", "Fetch a remote vault.")
 	vaultFetchUrl  = vaultFetch.Arg("url", "Remote url, e.g. git@github.com/passward/test.git").Required().String()
@@ -65,14 +173,66 @@ func Run() {
 	switch kingpin.MustParse(app.Parse(os.Args[1:])) {
 
 	case setup.FullCommand():
-		commands.Setup()
+		opts := commands.SetupOptions{
+			Email:         *setupEmail,
+			Name:          *setupName,
+			PublicKey:     *setupPublicKey,
+			PrivateKey:    *setupPrivateKey,
+			PassphraseEnv: *setupPassphraseEnv,
+			Home:          *setupHome,
+		}
+		if opts.NonInteractive() {
+			commands.SetupNonInteractive(opts)
+		} else {
+			commands.Setup(opts.Home)
+		}
 
 	case vault.FullCommand():
 		println("Subcommand for `vault` is required.")
 		app.CommandUsage(os.Stderr, vault.FullCommand())
 
 	case revealSecret.FullCommand():
-		commands.VaultSecretReveal(*revealSecretVaultName, *revealSecretSite)
+		site := *revealSecretSite
+		if site == "" {
+			site = *revealSecretSiteFlag
+		}
+		if site == "" {
+			println("A site is required.")
+			app.CommandUsage(os.Stderr, revealSecret.FullCommand())
+			os.Exit(1)
+		}
+		commands.VaultSecretReveal(*revealSecretVaultName, site, *revealSecretHistory)
+
+	case editSecret.FullCommand():
+		commands.VaultSecretEdit(*editSecretName, *editSecretSite, *editSecretUsername, *editSecretPassword, *editSecretDescription,
+			*editSecretFields, *editSecretFieldFiles)
+
+	case agent.FullCommand():
+		commands.Agent(*agentIdleTimeout)
+
+	case lock.FullCommand():
+		commands.Lock()
+
+	case search.FullCommand():
+		commands.Search(*searchPattern, *searchVaultName, *searchRegex, *searchFields)
+
+	case otp.FullCommand():
+		commands.VaultOtp(*otpVaultName, *otpSite)
+
+	case attach.FullCommand():
+		commands.VaultAttach(*attachVaultName, *attachSite, *attachFile, *attachName)
+
+	case extract.FullCommand():
+		commands.VaultExtract(*extractVaultName, *extractSite, *extractName, *extractOut)
+
+	case removeSecret.FullCommand():
+		commands.VaultSecretRemove(*removeSecretVaultName, *removeSecretSite)
+
+	case renameSecret.FullCommand():
+		commands.VaultSecretRename(*renameSecretVaultName, *renameSecretSite, *renameSecretTo)
+
+	case restore.FullCommand():
+		commands.VaultRestore(*restoreVaultName, *restoreSite, *restoreAt, *restoreVaultWide)
 
 	case vaultAddUser.FullCommand():
 		commands.VaultAddUser(*vaultAddUserVaultName, *vaultAddUserEmail)
@@ -81,7 +241,7 @@ func Run() {
 		commands.VaultRemoveUser(*vaultRemoveUserVaultName, *vaultRemoveUserEmail)
 
 	case vaultNew.FullCommand():
-		commands.VaultNew(*vaultNewName)
+		commands.VaultNew(*vaultNewName, *vaultNewEncryptNames)
 
 	case vaultUse.FullCommand():
 		commands.VaultUse(*vaultUseName)
@@ -93,7 +253,19 @@ func Run() {
 		commands.VaultFetch(*vaultFetchUrl, *vaultFetchName)
 
 	case vaultSync.FullCommand():
-		commands.VaultSync(*vaultSyncName)
+		commands.VaultSync(*vaultSyncName, *vaultSyncAbort)
+
+	case vaultEnrollAgent.FullCommand():
+		commands.VaultEnrollAgent(*vaultEnrollAgentName)
+
+	case vaultRotateKey.FullCommand():
+		commands.VaultRotateKey(*vaultRotateKeyName)
+
+	case vaultUpgrade.FullCommand():
+		commands.VaultUpgrade(*vaultUpgradeName)
+
+	case vaultLog.FullCommand():
+		commands.VaultLog(*vaultLogName, *vaultLogSite, *vaultLogUser, *vaultLogSince, *vaultLogJson)
 
 	case vaultShow.FullCommand():
 		commands.VaultShow(*vaultShowName)
@@ -102,7 +274,30 @@ func Run() {
 		commands.VaultList()
 
 	case addSecret.FullCommand():
-		commands.VaultSecretAdd(*addSecretName, *addSecretSite, *addSecretUsername, *addSecretPassword, *addSecretDescription)
+		var gen *commands.Generator
+		if *addSecretGenerate {
+			gen = &commands.Generator{
+				Length:           *addSecretLength,
+				Classes:          *addSecretClasses,
+				ExcludeAmbiguous: *addSecretExcludeAmbiguous,
+				Words:            *addSecretWords,
+				Wordlist:         *addSecretWordlist,
+				Show:             *addSecretShow,
+			}
+		}
+		secret := commands.SecretInput{Value: *addSecretPassword, Stdin: *addSecretPasswordStdin, File: *addSecretPasswordFile}
+		commands.VaultSecretAdd(*addSecretName, *addSecretSite, *addSecretUsername, secret, *addSecretDescription,
+			*addSecretFields, *addSecretFieldFiles, gen)
+
+	case field.FullCommand():
+		println("Subcommand for `field` is required.")
+		app.CommandUsage(os.Stderr, field.FullCommand())
+
+	case fieldSet.FullCommand():
+		commands.FieldSet(*fieldSetVaultName, *fieldSetSite, *fieldSetValues, *fieldSetFiles)
+
+	case fieldUnset.FullCommand():
+		commands.FieldUnset(*fieldUnsetVaultName, *fieldUnsetSite, *fieldUnsetKeys)
 
 	default:
 		app.Usage(os.Stderr)
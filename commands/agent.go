@@ -0,0 +1,71 @@
+package commands
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/jandre/passward/passward"
+	prompt "github.com/segmentio/go-prompt"
+)
+
+//
+// Agent unlocks the keys once and serves them to other commands, and to
+// git over the ssh-agent protocol, until it is stopped.  Run it in the
+// background, e.g. `passward agent &`.
+//
+func Agent(idleTimeout time.Duration) {
+
+	passwardPath := passward.DetectPasswardPath()
+
+	pw, err := passward.ReadPassward(passwardPath)
+
+	if err != nil {
+		log.Fatal("There was a problem loading the configuration. Did you run `passward setup?`", err)
+	}
+
+	agent := passward.NewAgent(pw.Path, pw.GetCredentials(), idleTimeout)
+
+	passphrase := prompt.PasswordMasked("Enter your passphrase to unlock your keys (empty for none)")
+	if err := agent.Unlock(passphrase); err != nil {
+		log.Fatal("Invalid passphrase.", err)
+	}
+
+	if err := agent.Listen(); err != nil {
+		log.Fatal("Unable to start the agent: ", err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		<-signals
+		agent.Close()
+	}()
+
+	fmt.Printf("Agent listening on: %s\n", passward.AgentSocketPath(pw.Path))
+	if idleTimeout > 0 {
+		fmt.Printf("Keys are locked after %s without use; run `passward lock` to lock them now.\n", idleTimeout)
+	}
+
+	// returns once the listener is closed
+	agent.Serve()
+}
+
+func Lock() {
+
+	passwardPath := passward.DetectPasswardPath()
+
+	if !passward.AgentRunning(passwardPath) {
+		fmt.Println("No agent is running.")
+		return
+	}
+
+	if err := passward.AgentLock(passwardPath); err != nil {
+		log.Fatal("Unable to lock the agent: ", err)
+	}
+
+	fmt.Println("Agent locked.")
+}
@@ -0,0 +1,55 @@
+package commands
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/jandre/passward/passward"
+)
+
+func FieldSet(name string, site string, fields []string, fieldFiles []string) {
+
+	values := parseFields(fields, fieldFiles)
+	if len(values) == 0 {
+		log.Fatal("At least one key=value field or --field-file is required.")
+	}
+
+	passwardPath := passward.DetectPasswardPath()
+
+	pw, err := passward.ReadPassward(passwardPath)
+
+	if err != nil {
+		log.Fatal("There was a problem loading the configuration. Did you run `passward setup?`", err)
+	}
+
+	vault := chooseVault(pw, name)
+
+	unlockPassward(pw, "Enter your passphrase to unlock your keys (empty for none)", vault)
+
+	if err := vault.SetFields(site, values); err != nil {
+		log.Fatal("Unable to set fields for: "+site+" ", err)
+	}
+
+	fmt.Println("Successfully saved.")
+}
+
+func FieldUnset(name string, site string, fields []string) {
+
+	passwardPath := passward.DetectPasswardPath()
+
+	pw, err := passward.ReadPassward(passwardPath)
+
+	if err != nil {
+		log.Fatal("There was a problem loading the configuration. Did you run `passward setup?`", err)
+	}
+
+	vault := chooseVault(pw, name)
+
+	unlockPassward(pw, "Enter your passphrase to unlock your keys (empty for none)", vault)
+
+	if err := vault.UnsetFields(site, fields); err != nil {
+		log.Fatal("Unable to remove fields for: "+site+" ", err)
+	}
+
+	fmt.Println("Successfully removed.")
+}
@@ -0,0 +1,74 @@
+package commands
+
+import (
+	"io/ioutil"
+	"log"
+	"strings"
+
+	"github.com/jandre/passward/passward"
+)
+
+//
+// Generator holds the `--generate` options of `store`.
+//
+type Generator struct {
+	Length           int
+	Classes          string
+	ExcludeAmbiguous bool
+	Words            int
+	Wordlist         string
+	Show             bool
+}
+
+// reads a word list with one word per line.  Only the last column is used,
+// so diceware lists like "11111 abacus" can be used as is.
+func readWordlist(file string) []string {
+	bytes, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Fatal("Unable to read word list: "+file+" ", err)
+	}
+
+	words := make([]string, 0)
+	for _, line := range strings.Split(string(bytes), "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			words = append(words, fields[len(fields)-1])
+		}
+	}
+	return words
+}
+
+func (g *Generator) generate() string {
+	var secret string
+	var err error
+
+	if g.Words > 0 {
+		var list []string
+		if g.Wordlist != "" {
+			list = readWordlist(g.Wordlist)
+		}
+		secret, err = passward.GeneratePassphrase(g.Words, "-", list)
+	} else {
+		opts := passward.GenerateOptions{Length: g.Length, ExcludeAmbiguous: g.ExcludeAmbiguous}
+		for _, class := range strings.Split(g.Classes, ",") {
+			switch strings.TrimSpace(class) {
+			case "lower":
+				opts.Lower = true
+			case "upper":
+				opts.Upper = true
+			case "digits":
+				opts.Digits = true
+			case "symbols":
+				opts.Symbols = true
+			case "":
+			default:
+				log.Fatal("Unknown character class: " + class + ", expected lower, upper, digits or symbols.")
+			}
+		}
+		secret, err = passward.GeneratePassword(opts)
+	}
+
+	if err != nil {
+		log.Fatal("Unable to generate passphrase: ", err)
+	}
+	return secret
+}
@@ -0,0 +1,45 @@
+package commands
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/jandre/passward/passward"
+)
+
+func Search(pattern string, vaultName string, regex bool, fields bool) {
+
+	passwardPath := passward.DetectPasswardPath()
+
+	pw, err := passward.ReadPassward(passwardPath)
+
+	if err != nil {
+		log.Fatal("There was a problem loading the configuration. Did you run `passward setup?`", err)
+	}
+
+	opts := passward.SearchOptions{Pattern: pattern, Regex: regex, Vault: vaultName, Fields: fields}
+
+	if pw.NeedsUnlock(opts) {
+		unlockPassward(pw, "Enter your passphrase to unlock your keys (empty for none)", pw.SearchedVaults(opts)...)
+	}
+
+	results, err := pw.Search(opts)
+	if err != nil {
+		log.Fatal("Unable to search: ", err)
+	}
+
+	if len(results) == 0 {
+		fmt.Println("No sites found.")
+		os.Exit(1)
+	}
+
+	for _, result := range results {
+		if fields {
+			fmt.Printf("%s\t%s\t(%s)\n", result.Vault, result.Entry, strings.Join(result.Matched, ", "))
+		} else {
+			fmt.Printf("%s\t%s\n", result.Vault, result.Entry)
+		}
+	}
+}
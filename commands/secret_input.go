@@ -0,0 +1,104 @@
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	prompt "github.com/segmentio/go-prompt"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+//
+// SecretInput is where a secret comes from: the command line (`Value`),
+// stdin, a file, or, if none is set, a masked prompt.
+//
+type SecretInput struct {
+	Value string
+	Stdin bool
+	File  string
+}
+
+// number of sources that were given
+func (s SecretInput) sources() int {
+	count := 0
+	if s.Value != "" {
+		count++
+	}
+	if s.Stdin {
+		count++
+	}
+	if s.File != "" {
+		count++
+	}
+	return count
+}
+
+// drops the trailing newline of a single-line value, as left by `echo` or
+// most editors.  Multi-line values such as PEM keys are kept as is.
+func trimSingleLine(value string) string {
+	trimmed := strings.TrimRight(value, "\r\n")
+	if !strings.Contains(trimmed, "\n") {
+		return trimmed
+	}
+	return value
+}
+
+//
+// read returns the secret.  `name` is used in the prompts.
+//
+func (s SecretInput) read(name string) string {
+	if s.sources() > 1 {
+		log.Fatal("Give the " + name + " only once: as a flag, on stdin or in a file.")
+	}
+
+	switch {
+	case s.Value != "":
+		return s.Value
+
+	case s.Stdin:
+		bytes, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			log.Fatal("Unable to read the "+name+" from stdin: ", err)
+		}
+		return trimSingleLine(string(bytes))
+
+	case s.File != "":
+		bytes, err := ioutil.ReadFile(s.File)
+		if err != nil {
+			log.Fatal("Unable to read the "+name+" from: "+s.File+" ", err)
+		}
+		return trimSingleLine(string(bytes))
+	}
+
+	value := prompt.PasswordMasked(fmt.Sprintf("Enter the %s to store", name))
+	if value == "" {
+		log.Fatal("The " + name + " can't be empty.")
+	}
+	if prompt.PasswordMasked(fmt.Sprintf("Enter the %s again to confirm", name)) != value {
+		log.Fatal("The " + name + "s don't match.")
+	}
+	return value
+}
+
+//
+// readTtyPassphrase asks for a passphrase on the terminal itself, for when
+// stdin carries a secret.
+//
+func readTtyPassphrase(msg string) string {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		log.Fatal("A terminal is needed to unlock your keys when reading from stdin. ", err)
+	}
+	defer tty.Close()
+
+	fmt.Fprint(tty, msg+": ")
+	passphrase, err := terminal.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(tty)
+	if err != nil {
+		log.Fatal("Unable to read your passphrase: ", err)
+	}
+	return string(passphrase)
+}
@@ -6,7 +6,6 @@ import (
 	"os"
 
 	"github.com/jandre/passward/passward"
-	"github.com/jandre/passward/util"
 	prompt "github.com/segmentio/go-prompt"
 )
 
@@ -19,31 +18,35 @@ func makeSshKeyDescriptions(keys []*passward.SshKeyRing) []string {
 	return result
 }
 
+//
+// ChooseSshKeyRing asks which of the detected ssh keys to use. It returns
+// nil if a new keypair should be generated instead.
+//
 func ChooseSshKeyRing() *passward.SshKeyRing {
 	sshKeysPath := passward.GetSshKeyRingPath()
 	sshKeys := passward.DetectSshKeyRing(sshKeysPath)
 
-	if sshKeys != nil && len(sshKeys) > 0 {
-		fmt.Printf("Wonderful. We've detected the following keypairs, choose the ones you want to use: \n")
-		sshKeyDescriptions := makeSshKeyDescriptions(sshKeys)
-		sshKeyDescriptions = append(sshKeyDescriptions, "None of these, generate new keys for me.")
-		id := prompt.Choose("Select keys to use", sshKeyDescriptions)
-		if id != len(sshKeys) {
-			return sshKeys[id]
-		} else {
-			// TODO: have the app run ssh-keygen all on its lonesome.
-			fmt.Println("Please run ssh-keygen to generate the keys.")
-			os.Exit(1)
-		}
-	} else {
-		fmt.Printf("No ssh keys detected in %s!\n", sshKeysPath)
-		fmt.Println("Please run ssh-keygen to generate the keys.")
+	if sshKeys == nil || len(sshKeys) == 0 {
+		fmt.Printf("No ssh keys detected in %s, so we'll generate a keypair for passward.\n", sshKeysPath)
+		return nil
+	}
+
+	fmt.Printf("Wonderful. We've detected the following keypairs, choose the ones you want to use: \n")
+	sshKeyDescriptions := makeSshKeyDescriptions(sshKeys)
+	sshKeyDescriptions = append(sshKeyDescriptions, "None of these, generate new keys for me.")
+	id := prompt.Choose("Select keys to use", sshKeyDescriptions)
+	if id == len(sshKeys) {
+		return nil
+	}
+
+	if !sshKeys[id].Supported() {
+		fmt.Println("Sorry, this key type is not supported. Use an RSA, Ed25519 or ECDSA key.")
 		os.Exit(1)
 	}
-	return nil
+	return sshKeys[id]
 }
 
-func setupCredentials() (*passward.Credentials, error) {
+func setupCredentials(passwardPath string) (*passward.Credentials, error) {
 
 	email := prompt.StringRequired("Please enter your email address")
 	name := prompt.String("Please enter your name.  We'll use your email address if this is blank")
@@ -56,25 +59,61 @@ func setupCredentials() (*passward.Credentials, error) {
 
 	authMethods := []string{
 		"Import SSH keys - Use your ssh keys to encrypt your password vaults.",
-		"Generate custom keys - Generate custom public keypair.",
+		"Generate custom keys - Generate a keypair used only by passward.",
 	}
 
 	fmt.Println("Passward uses public key encryption to store secrets. You can use existing keys from SSH, or generate new ones.")
 	chosen := prompt.Choose("Select your authentication method", authMethods)
 
 	if chosen == 0 {
-		setupSshAuth(&creds)
-		return &creds, nil
-	} else {
-		log.Fatal("Sorry, this is not yet supported!")
+		if sshKeys := ChooseSshKeyRing(); sshKeys != nil {
+			setupSshAuth(&creds, sshKeys)
+			return &creds, nil
+		}
 	}
-	return nil, nil
 
+	if err := setupGeneratedKeys(&creds, passwardPath); err != nil {
+		return nil, err
+	}
+	return &creds, nil
 }
 
-func setupSshAuth(creds *passward.Credentials) {
-	sshKeys := ChooseSshKeyRing()
+// generates a passphrase protected keypair in $PASSWARD_HOME/keys
+func setupGeneratedKeys(creds *passward.Credentials, passwardPath string) error {
+	keysPath := passward.KeysPath(passwardPath)
 
+	fmt.Println()
+	fmt.Println("We'll generate a new keypair in:", keysPath)
+	fmt.Println("It is only used by passward, so your vaults stay separate from the keys you log in to servers with.")
+	fmt.Println("If an earlier setup left keys there, they're reused when your passphrase unlocks them.")
+
+	var passphrase string
+	for passphrase == "" {
+		passphrase = prompt.PasswordMasked("Please enter a passphrase to protect the private key")
+		if passphrase == "" {
+			fmt.Println("The passphrase can't be empty.")
+			continue
+		}
+		if prompt.PasswordMasked("Please enter the passphrase again") != passphrase {
+			fmt.Println("The passphrases don't match, please try again.")
+			passphrase = ""
+		}
+	}
+
+	fmt.Println("Generating keys...")
+	sshKeys, err := passward.GenerateSshKeyRing(keysPath, creds.Email, passphrase)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Great! We've generated the keypair: ", sshKeys.GetDescription())
+
+	creds.PrivateKeyPath = sshKeys.PrivateKeyPath
+	creds.PublicKeyPath = sshKeys.PublicKeyPath
+	return nil
+}
+
+func setupSshAuth(creds *passward.Credentials, sshKeys *passward.SshKeyRing) {
 	fmt.Println()
 	fmt.Println("Great! We'll be using the keypair: ", sshKeys.GetDescription())
 
@@ -114,12 +153,16 @@ func setupSshAuth(creds *passward.Credentials) {
 }
 
 //
-// Setup a new passward installation
+// Setup a new passward installation in `home`, or the detected
+// passward path if it is empty.
 //
-func Setup() {
-	passwardPath := passward.DetectPasswardPath()
+func Setup(home string) {
+	passwardPath, err := setupPath(home)
+	if err != nil {
+		log.Fatal("Invalid passward home: ", err)
+	}
 
-	if util.DirectoryExists(passwardPath) {
+	if passward.PasswardExists(passwardPath) {
 		fmt.Println("Oh no! We already detected a passward installation at: ", passwardPath, "")
 		fmt.Println("Please remove this directory, or set environment variable PASSWARD_HOME=<path> to use a different path.")
 		os.Exit(1)
@@ -130,7 +173,7 @@ func Setup() {
 
 	fmt.Println("")
 
-	creds, err := setupCredentials()
+	creds, err := setupCredentials(passwardPath)
 
 	if err != nil {
 		fmt.Println("Unable to setup credentials.  Please re-run `passward setup`.", err)
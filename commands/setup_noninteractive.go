@@ -0,0 +1,185 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jandre/passward/passward"
+)
+
+// exit codes of a non-interactive setup, also listed in `passward setup
+// --help` and the README
+const (
+	SetupExitInvalidArgs  = 2 // missing or conflicting flags
+	SetupExitExists       = 3 // there is already a passward installation
+	SetupExitInvalidKeys  = 4 // keys can't be read, decrypted or generated
+	SetupExitConfigFailed = 5 // the config can't be saved
+)
+
+//
+// SetupOptions holds the flags of a non-interactive `setup`.
+//
+type SetupOptions struct {
+	Email         string
+	Name          string
+	PublicKey     string
+	PrivateKey    string
+	PassphraseEnv string
+	Home          string
+}
+
+//
+// SetupError is a failed non-interactive setup, with the exit code it
+// ends with.
+//
+type SetupError struct {
+	Code    int
+	Message string
+}
+
+func (e *SetupError) Error() string {
+	return e.Message
+}
+
+func setupError(code int, args ...interface{}) *SetupError {
+	return &SetupError{Code: code, Message: fmt.Sprintln(args...)}
+}
+
+//
+// NonInteractive returns true if any flag other than `--home` was given,
+// in which case setup never prompts.
+//
+func (o *SetupOptions) NonInteractive() bool {
+	return o.Email != "" || o.Name != "" || o.PublicKey != "" || o.PrivateKey != "" || o.PassphraseEnv != ""
+}
+
+// reads the key passphrase from the environment variable named by
+// `--passphrase-env`.  No variable means the private key is unencrypted.
+func (o *SetupOptions) passphrase() (string, *SetupError) {
+	if o.PassphraseEnv == "" {
+		return "", nil
+	}
+	passphrase, ok := os.LookupEnv(o.PassphraseEnv)
+	if !ok {
+		return "", setupError(SetupExitInvalidArgs, "Environment variable "+o.PassphraseEnv+" is not set.")
+	}
+	return passphrase, nil
+}
+
+// loads the keys given by `--public-key` and `--private-key`, or generates
+// a keypair in $PASSWARD_HOME/keys if neither was given
+func (o *SetupOptions) keys(passwardPath string, email string, passphrase string) (*passward.SshKeyRing, *SetupError) {
+	if o.PublicKey == "" && o.PrivateKey == "" {
+		if passphrase == "" {
+			return nil, setupError(SetupExitInvalidArgs, "--passphrase-env is required to generate keys.")
+		}
+		keys, err := passward.GenerateSshKeyRing(passward.KeysPath(passwardPath), email, passphrase)
+		if err != nil {
+			return nil, setupError(SetupExitInvalidKeys, "Unable to generate keys:", err)
+		}
+		return keys, nil
+	}
+
+	if o.PublicKey == "" || o.PrivateKey == "" {
+		return nil, setupError(SetupExitInvalidArgs, "--public-key and --private-key must be given together.")
+	}
+
+	publicKeyPath, err := filepath.Abs(o.PublicKey)
+	if err != nil {
+		return nil, setupError(SetupExitInvalidArgs, "Invalid public key path:", err)
+	}
+	privateKeyPath, err := filepath.Abs(o.PrivateKey)
+	if err != nil {
+		return nil, setupError(SetupExitInvalidArgs, "Invalid private key path:", err)
+	}
+
+	keys, err := passward.NewSshKeyRing(publicKeyPath, privateKeyPath, passphrase)
+	if err != nil {
+		return nil, setupError(SetupExitInvalidKeys, "Unable to load keys:", err)
+	}
+	if !keys.Supported() {
+		return nil, setupError(SetupExitInvalidKeys, "Unsupported key type. Use an RSA, Ed25519 or ECDSA key.")
+	}
+	return keys, nil
+}
+
+// the absolute path to install passward in: `home`, or else the detected
+// passward path
+func setupPath(home string) (string, error) {
+	if home == "" {
+		home = passward.DetectPasswardPath()
+	}
+	return filepath.Abs(home)
+}
+
+//
+// RunSetup creates a passward installation from `opts` without reading
+// from the terminal, and returns the path it was installed in.
+//
+func RunSetup(opts SetupOptions) (string, *SetupError) {
+	if opts.Email == "" {
+		return "", setupError(SetupExitInvalidArgs, "--email is required.")
+	}
+
+	passwardPath, err := setupPath(opts.Home)
+	if err != nil {
+		return "", setupError(SetupExitInvalidArgs, "Invalid passward home:", err)
+	}
+
+	if passward.PasswardExists(passwardPath) {
+		return "", setupError(SetupExitExists, "A passward installation already exists at:", passwardPath)
+	}
+
+	name := opts.Name
+	if name == "" {
+		name = opts.Email
+	}
+
+	passphrase, setupErr := opts.passphrase()
+	if setupErr != nil {
+		return "", setupErr
+	}
+
+	keys, setupErr := opts.keys(passwardPath, opts.Email, passphrase)
+	if setupErr != nil {
+		return "", setupErr
+	}
+
+	creds := passward.Credentials{
+		Email:          opts.Email,
+		Name:           name,
+		PublicKeyPath:  keys.PublicKeyPath,
+		PrivateKeyPath: keys.PrivateKeyPath,
+	}
+
+	cfg, err := passward.NewPassward(passwardPath)
+	if err != nil {
+		return "", setupError(SetupExitConfigFailed, "Unable to create passward config:", err)
+	}
+
+	cfg.SetCredentials(&creds)
+
+	if err := cfg.Save(); err != nil {
+		return "", setupError(SetupExitConfigFailed, "Unable to save passward config:", err)
+	}
+
+	return passwardPath, nil
+}
+
+//
+// SetupNonInteractive runs `RunSetup`, exiting with its SetupExit code if
+// the options are invalid.
+//
+func SetupNonInteractive(opts SetupOptions) {
+	passwardPath, err := RunSetup(opts)
+	if err != nil {
+		fmt.Fprint(os.Stderr, err.Error())
+		os.Exit(err.Code)
+	}
+
+	fmt.Println("Setup is complete:", passwardPath)
+	if opts.Home != "" && opts.Home != os.Getenv("PASSWARD_HOME") {
+		fmt.Println("Export PASSWARD_HOME=" + passwardPath + " to use this installation.")
+	}
+}
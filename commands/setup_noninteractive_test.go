@@ -0,0 +1,65 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunSetupValidation(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "passward-setup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Setenv("PASSWARD_TEST_PASSPHRASE", "secret")
+	defer os.Unsetenv("PASSWARD_TEST_PASSPHRASE")
+
+	home := filepath.Join(dir, "home")
+	missing := filepath.Join(dir, "missing")
+
+	for _, test := range []struct {
+		name string
+		opts SetupOptions
+		code int
+	}{
+		{"no email", SetupOptions{Home: home}, SetupExitInvalidArgs},
+		{"public key only", SetupOptions{Email: "me@example.com", PublicKey: missing + ".pub", Home: home}, SetupExitInvalidArgs},
+		{"private key only", SetupOptions{Email: "me@example.com", PrivateKey: missing, Home: home}, SetupExitInvalidArgs},
+		{"generate without a passphrase", SetupOptions{Email: "me@example.com", Home: home}, SetupExitInvalidArgs},
+		{"unset passphrase variable", SetupOptions{Email: "me@example.com", PassphraseEnv: "PASSWARD_TEST_UNSET", Home: home}, SetupExitInvalidArgs},
+		{"missing keys", SetupOptions{Email: "me@example.com", PublicKey: missing + ".pub", PrivateKey: missing, Home: home}, SetupExitInvalidKeys},
+	} {
+		if _, err := RunSetup(test.opts); err == nil {
+			t.Fatal(test.name, "- expected setup to fail")
+		} else if err.Code != test.code {
+			t.Fatal(test.name, "- expected exit code", test.code, "got:", err.Code, err)
+		}
+	}
+
+	// a relative home is made absolute
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	opts := SetupOptions{Email: "me@example.com", PassphraseEnv: "PASSWARD_TEST_PASSPHRASE", Home: "home"}
+	passwardPath, setupErr := RunSetup(opts)
+	if setupErr != nil {
+		t.Fatal(setupErr)
+	}
+	if !filepath.IsAbs(passwardPath) {
+		t.Fatal("expected an absolute path, got:", passwardPath)
+	}
+
+	if _, err := RunSetup(opts); err == nil || err.Code != SetupExitExists {
+		t.Fatal("expected a second setup to fail with", SetupExitExists, "got:", err)
+	}
+}
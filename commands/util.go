@@ -1,9 +1,15 @@
 package commands
 
 import (
+	"io/ioutil"
 	"log"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/jandre/passward/passward"
+	"github.com/jandre/passward/util"
+	prompt "github.com/segmentio/go-prompt"
 )
 
 func chooseVault(pw *passward.Passward, name string) *passward.Vault {
@@ -24,3 +30,131 @@ func chooseVault(pw *passward.Passward, name string) *passward.Vault {
 
 	return vault
 }
+
+//
+// unlockPassward unlocks the keys of `pw` to use `vaults`: through the
+// agent, if one is running and unlocked, through ssh-agent if every one of
+// `vaults` is enrolled, or else by asking for the passphrase with `msg`.
+//
+func unlockPassward(pw *passward.Passward, msg string, vaults ...*passward.Vault) {
+	unlockPasswardWith(pw, func() string { return prompt.PasswordMasked(msg) }, vaults...)
+}
+
+// returns true if ssh-agent can unlock every one of `vaults`
+func sshAgentEnrolled(vaults []*passward.Vault) bool {
+	for _, vault := range vaults {
+		if !vault.SshAgentEnrolled() {
+			return false
+		}
+	}
+	return len(vaults) > 0
+}
+
+//
+// unlockPasswardWith is `unlockPassward` with `ask` reading the passphrase.
+// A passphrase that was asked for unlocks a locked agent, so the next
+// commands don't ask again.
+//
+func unlockPasswardWith(pw *passward.Passward, ask func() string, vaults ...*passward.Vault) {
+	if err := pw.GetCredentials().UnlockWithAgent(pw.Path); err == nil {
+		return
+	}
+
+	if pw.GetCredentials().SshAgent && sshAgentEnrolled(vaults) {
+		err := pw.GetCredentials().UnlockWithSshAgent()
+		if err == nil {
+			return
+		}
+		log.Println("Unable to unlock through ssh-agent: ", err)
+	}
+
+	passphrase := ask()
+	if err := pw.Unlock(passphrase); err != nil {
+		log.Fatal("Invalid passphrase.", err)
+	}
+
+	if passward.AgentRunning(pw.Path) {
+		if err := passward.AgentUnlock(pw.Path, passphrase); err != nil {
+			log.Println("Unable to unlock the agent: ", err)
+		}
+	}
+}
+
+//
+// parseSince parses a date (2006-01-02), a timestamp (RFC 3339) or a
+// duration before now (72h).
+//
+func parseSince(since string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", since, time.Local); err == nil {
+		return t, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, since); err == nil {
+		return t, nil
+	}
+
+	d, err := time.ParseDuration(since)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Now().Add(-d), nil
+}
+
+// splits a key=value pair; the value is never echoed since it may be secret
+func splitField(pair string) (string, string) {
+	idx := strings.Index(pair, "=")
+	if idx <= 0 {
+		log.Fatal("Invalid field, expected key=value.")
+	}
+	return pair[:idx], pair[idx+1:]
+}
+
+//
+// parseFields parses key=value `values`, and key=path `files` whose value
+// is read from the file at path.
+//
+func parseFields(values []string, files []string) map[string]string {
+	fields := make(map[string]string)
+
+	for _, pair := range values {
+		key, val := splitField(pair)
+		fields[key] = val
+	}
+
+	for _, pair := range files {
+		key, file := splitField(pair)
+		bytes, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.Fatal("Unable to read field file: "+file+" ", err)
+		}
+		fields[key] = string(bytes)
+	}
+
+	return fields
+}
+
+//
+// privateTempDir creates a directory only the current user can read, in
+// memory-backed storage (/dev/shm, $XDG_RUNTIME_DIR) when available so
+// decrypted secrets never reach the disk.
+//
+func privateTempDir() (string, error) {
+	base := ""
+	for _, dir := range []string{"/dev/shm", os.Getenv("XDG_RUNTIME_DIR")} {
+		if dir != "" && util.DirectoryExists(dir) {
+			base = dir
+			break
+		}
+	}
+
+	if base == "" {
+		log.Println("Warning: no memory-backed directory found, using the default temp directory.")
+	}
+
+	dir, err := ioutil.TempDir(base, "passward")
+	if err != nil {
+		return "", err
+	}
+
+	return dir, os.Chmod(dir, 0700)
+}
@@ -20,10 +20,7 @@ func VaultAddUser(name string, email string) {
 
 	vault := chooseVault(pw, name)
 
-	passphrase := prompt.PasswordMasked("Enter your passphrase to unlock your keys (empty for none)")
-	if err := pw.Unlock(passphrase); err != nil {
-		log.Fatal("Invalid passphrase.", err)
-	}
+	unlockPassward(pw, "Enter your passphrase to unlock your keys (empty for none)", vault)
 
 	log.Println("Please enter the public key (e.g. the contents of ~/.ssh/id_rsa.pub).")
 	publicKey := prompt.StringRequired("Enter key")
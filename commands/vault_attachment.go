@@ -0,0 +1,107 @@
+package commands
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+
+	"github.com/jandre/passward/passward"
+)
+
+// formats `size` bytes for humans, e.g. 1.5 MB
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+func VaultAttach(name string, site string, file string, attachmentName string) {
+
+	passwardPath := passward.DetectPasswardPath()
+
+	pw, err := passward.ReadPassward(passwardPath)
+
+	if err != nil {
+		log.Fatal("There was a problem loading the configuration. Did you run `passward setup?`", err)
+	}
+
+	vault := chooseVault(pw, name)
+
+	unlockPassward(pw, "Enter your passphrase to unlock your keys (empty for none)", vault)
+
+	f, err := os.Open(file)
+	if err != nil {
+		log.Fatal("Unable to open file: "+file+" ", err)
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		log.Fatal("Unable to open file: "+file+" ", err)
+	}
+
+	if attachmentName == "" {
+		attachmentName = path.Base(file)
+	}
+
+	attachment, err := vault.AttachFile(site, attachmentName, f, stat.Mode())
+	if err != nil {
+		log.Fatal("Unable to attach file to: "+site+" ", err)
+	}
+
+	fmt.Printf("Attached `%s` (%s) to site: %s.\n", attachment.Name, formatSize(attachment.Size), site)
+}
+
+//
+// VaultExtract writes the attachment `attachmentName` to `out`, or to stdout
+// if `out` is "-".
+//
+func VaultExtract(name string, site string, attachmentName string, out string) {
+
+	passwardPath := passward.DetectPasswardPath()
+
+	pw, err := passward.ReadPassward(passwardPath)
+
+	if err != nil {
+		log.Fatal("There was a problem loading the configuration. Did you run `passward setup?`", err)
+	}
+
+	vault := chooseVault(pw, name)
+
+	unlockPassward(pw, "Enter your passphrase to unlock your keys (empty for none)", vault)
+
+	if out == "-" {
+		if _, err := vault.ExtractFile(site, attachmentName, os.Stdout); err != nil {
+			log.Fatal("Unable to extract attachment: "+attachmentName+" ", err)
+		}
+		return
+	}
+
+	// created private, then given the stored mode once fully written
+	f, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		log.Fatal("Unable to create file: "+out+" ", err)
+	}
+
+	attachment, err := vault.ExtractFile(site, attachmentName, f)
+	f.Close()
+	if err != nil {
+		os.Remove(out)
+		log.Fatal("Unable to extract attachment: "+attachmentName+" ", err)
+	}
+
+	if err := os.Chmod(out, attachment.Mode); err != nil {
+		log.Fatal("Unable to set the mode of: "+out+" ", err)
+	}
+
+	fmt.Printf("Extracted `%s` (%s) to: %s\n", attachment.Name, formatSize(attachment.Size), out)
+}
@@ -0,0 +1,46 @@
+package commands
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/jandre/passward/passward"
+	prompt "github.com/segmentio/go-prompt"
+)
+
+//
+// VaultEnrollAgent lets the vault be unlocked through ssh-agent.  The key
+// file is needed this once, so it doesn't go through `unlockPassward`.
+//
+func VaultEnrollAgent(name string) {
+
+	passwardPath := passward.DetectPasswardPath()
+
+	pw, err := passward.ReadPassward(passwardPath)
+
+	if err != nil {
+		log.Fatal("There was a problem loading the configuration. Did you run `passward setup?`", err)
+	}
+
+	vault := chooseVault(pw, name)
+
+	passphrase := prompt.PasswordMasked("Enter your passphrase to unlock your keys (empty for none)")
+	if err := pw.Unlock(passphrase); err != nil {
+		log.Fatal("Invalid passphrase.", err)
+	}
+
+	if err := vault.EnrollSshAgent(); err != nil {
+		log.Fatal("Unable to set up ssh-agent unlock: ", err)
+	}
+
+	pw.GetCredentials().SshAgent = true
+	if err := pw.Save(); err != nil {
+		log.Fatal("Unable to save the configuration: ", err)
+	}
+
+	fmt.Printf("Vault `%s` can now be unlocked through ssh-agent.\n", vault.Name)
+	fmt.Println("Vaults that aren't enrolled still ask for your passphrase.")
+	if vault.HasRemote() {
+		fmt.Println("Sync your changes by running `passward vault sync`.")
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"os"
 
 	"github.com/jandre/passward/passward"
-	"github.com/segmentio/go-prompt"
 )
 
 func VaultFetch(url string, name string) {
@@ -19,14 +18,17 @@ func VaultFetch(url string, name string) {
 		log.Fatal("There was a problem loading the configuration. Did you run `passward setup?`", err)
 	}
 
-	passphrase := prompt.PasswordMasked("Enter your passphrase to unlock your keys (empty for none)")
-
-	if err := pw.Unlock(passphrase); err != nil {
-		log.Fatal("Invalid passphrase.", err)
-	}
+	unlockPassward(pw, "Enter your passphrase to unlock your keys (empty for none)")
 
 	vault, err := pw.FetchVault(url, name)
 
+	if sigErr, ok := err.(*passward.SignatureError); ok {
+		fmt.Println("Refusing to fetch: the remote vault contains a commit that is not signed by a vault user!")
+		fmt.Println("Error is:", sigErr)
+		fmt.Println("If the vault was created before commits were signed, a vault user must run `passward vault upgrade` and sync it first.")
+		os.Exit(1)
+	}
+
 	if err != nil {
 		fmt.Println("Unable fetch vault from remote:", url)
 		fmt.Println("Error is:", err)
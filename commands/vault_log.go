@@ -0,0 +1,83 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/jandre/passward/passward"
+)
+
+func formatAuditEvent(event *passward.AuditEvent) string {
+	subject := event.Site + event.User
+	if len(event.Fields) > 0 {
+		subject = fmt.Sprintf("%s (%s)", subject, strings.Join(event.Fields, ", "))
+	}
+	if subject == "" {
+		subject = event.Message
+	}
+
+	line := fmt.Sprintf("%s  %.8s  %s  %s  %s", event.Time.Format("2006-01-02 15:04"),
+		event.Commit, event.Email, event.Action, subject)
+	if event.Merge {
+		line += "  (merge)"
+	}
+
+	switch event.Signature {
+	case passward.SignatureUnsigned:
+		line += "  (unsigned)"
+	case passward.SignatureBad:
+		line += "  (BAD SIGNATURE)"
+	}
+	return line
+}
+
+func VaultLog(name string, site string, user string, since string, asJson bool) {
+
+	passwardPath := passward.DetectPasswardPath()
+
+	pw, err := passward.ReadPassward(passwardPath)
+
+	if err != nil {
+		log.Fatal("There was a problem loading the configuration. Did you run `passward setup?`", err)
+	}
+
+	vault := chooseVault(pw, name)
+
+	filter := passward.LogFilter{Site: site, User: user}
+	if since != "" {
+		if filter.Since, err = parseSince(since); err != nil {
+			log.Fatal("Invalid --since, expected a date like 2006-01-02 or a duration like 72h: ", err)
+		}
+	}
+
+	if vault.EncryptedNames {
+		unlockPassward(pw, "Site names are encrypted. Enter your passphrase to unlock your keys (empty for none)", vault)
+	}
+
+	events, err := vault.Log(filter)
+	if err != nil {
+		log.Fatal("Unable to read vault history: ", err)
+	}
+
+	if asJson {
+		encoder := json.NewEncoder(os.Stdout)
+		for _, event := range events {
+			if err := encoder.Encode(event); err != nil {
+				log.Fatal("Unable to write event: ", err)
+			}
+		}
+		return
+	}
+
+	if len(events) == 0 {
+		fmt.Println("No matching changes found.")
+		return
+	}
+
+	for _, event := range events {
+		fmt.Println(formatAuditEvent(event))
+	}
+}
@@ -5,10 +5,9 @@ import (
 	"log"
 
 	"github.com/jandre/passward/passward"
-	"github.com/segmentio/go-prompt"
 )
 
-func VaultNew(name string) {
+func VaultNew(name string, encryptNames bool) {
 
 	passwardPath := passward.DetectPasswardPath()
 
@@ -18,13 +17,9 @@ func VaultNew(name string) {
 		log.Fatal("There was a problem loading the configuration. Did you run `passward setup?`", err)
 	}
 
-	passphrase := prompt.PasswordMasked("Enter your passphrase to unlock your keys (empty for none)")
+	unlockPassward(pw, "Enter your passphrase to unlock your keys (empty for none)")
 
-	if err := pw.Unlock(passphrase); err != nil {
-		log.Fatal("Invalid passphrase.", err)
-	}
-
-	if err = pw.AddVault(name); err != nil {
+	if err = pw.AddVault(name, encryptNames); err != nil {
 		log.Fatal("Error creating vault: ", err)
 	}
 
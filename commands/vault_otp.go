@@ -0,0 +1,36 @@
+package commands
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/jandre/passward/passward"
+)
+
+//
+// VaultOtp prints the current one-time password of `site`.  Only the code
+// goes to stdout, so it can be piped.
+//
+func VaultOtp(name string, site string) {
+
+	passwardPath := passward.DetectPasswardPath()
+
+	pw, err := passward.ReadPassward(passwardPath)
+
+	if err != nil {
+		log.Fatal("There was a problem loading the configuration. Did you run `passward setup?`", err)
+	}
+
+	vault := chooseVault(pw, name)
+
+	unlockPassward(pw, "Enter your passphrase to unlock your keys (empty for none)", vault)
+
+	code, remaining, err := vault.TotpCode(site)
+	if err != nil {
+		log.Fatal("Unable to generate a one-time password for: "+site+" ", err)
+	}
+
+	fmt.Println(code)
+	fmt.Fprintf(os.Stderr, "Valid for %d more seconds.\n", int(remaining.Seconds()))
+}
@@ -21,10 +21,7 @@ func VaultRemoveUser(name string, email string) {
 
 	vault := chooseVault(pw, name)
 
-	passphrase := prompt.PasswordMasked("Enter your passphrase to unlock your keys (empty for none)")
-	if err := pw.Unlock(passphrase); err != nil {
-		log.Fatal("Invalid passphrase.", err)
-	}
+	unlockPassward(pw, "Enter your passphrase to unlock your keys (empty for none)", vault)
 
 	user := vault.GetUserByEmail(email)
 
@@ -40,4 +37,9 @@ func VaultRemoveUser(name string, email string) {
 		log.Fatal("Unable to remove user: ", err)
 	}
 
+	fmt.Printf("User `%s` removed from vault: %s. The vault master key has been rotated.\n", email, vault.Name)
+	if vault.HasRemote() {
+		fmt.Println("Sync your changes by running `passward vault sync`.")
+	}
+
 }
@@ -0,0 +1,62 @@
+package commands
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/jandre/passward/passward"
+)
+
+// finds the revision named by `at`, either a date or a commit id
+func chooseRevision(vault *passward.Vault, at string) *passward.Revision {
+	var rev *passward.Revision
+	var err error
+
+	if when, parseErr := parseSince(at); parseErr == nil {
+		rev, err = vault.RevisionAt(when)
+	} else {
+		rev, err = vault.LookupRevision(at)
+	}
+
+	if err != nil {
+		log.Fatal("Unable to find revision: "+at+" ", err)
+	}
+	return rev
+}
+
+func VaultRestore(name string, site string, at string, vaultWide bool) {
+
+	if site == "" && !vaultWide {
+		log.Fatal("Either --site or --vault-wide is required.")
+	}
+
+	passwardPath := passward.DetectPasswardPath()
+
+	pw, err := passward.ReadPassward(passwardPath)
+
+	if err != nil {
+		log.Fatal("There was a problem loading the configuration. Did you run `passward setup?`", err)
+	}
+
+	vault := chooseVault(pw, name)
+	rev := chooseRevision(vault, at)
+
+	unlockPassward(pw, "Enter your passphrase to unlock your keys (empty for none)", vault)
+
+	if vaultWide {
+		count, err := vault.RestoreAll(rev)
+		if err != nil {
+			log.Fatal("Unable to restore vault: ", err)
+		}
+		fmt.Printf("Restored %d sites from revision %s (%s).\n", count, rev.ShortId(), rev.When.Format("2006-01-02 15:04"))
+	} else {
+		if err := vault.RestoreEntry(site, rev); err != nil {
+			log.Fatal("Unable to restore entry for: "+site+" ", err)
+		}
+		fmt.Printf("Restored %s from revision %s (%s).\n", site, rev.ShortId(), rev.When.Format("2006-01-02 15:04"))
+	}
+
+	if vault.HasRemote() {
+		fmt.Println("Sync your changes by running `passward vault sync`.")
+	}
+}
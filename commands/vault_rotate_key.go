@@ -0,0 +1,32 @@
+package commands
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/jandre/passward/passward"
+)
+
+func VaultRotateKey(name string) {
+
+	passwardPath := passward.DetectPasswardPath()
+
+	pw, err := passward.ReadPassward(passwardPath)
+
+	if err != nil {
+		log.Fatal("There was a problem loading the configuration. Did you run `passward setup?`", err)
+	}
+
+	vault := chooseVault(pw, name)
+
+	unlockPassward(pw, "Enter your passphrase to unlock your keys (empty for none)", vault)
+
+	if err := vault.RotateKey(); err != nil {
+		log.Fatal("Unable to rotate master key: ", err)
+	}
+
+	fmt.Printf("Master key for vault `%s` rotated on %s.\n", vault.Name, vault.LastKeyRotation.Format("2006-01-02"))
+	if vault.HasRemote() {
+		fmt.Println("Sync your changes by running `passward vault sync`.")
+	}
+}
@@ -5,10 +5,17 @@ import (
 	"log"
 
 	"github.com/jandre/passward/passward"
-	"github.com/segmentio/go-prompt"
 )
 
-func VaultSecretAdd(name string, site string, username string, password string, description string) {
+//
+// VaultSecretAdd stores a site.  If `gen` is set, the passphrase is generated
+// instead of read from `secret`.
+//
+func VaultSecretAdd(name string, site string, username string, secret SecretInput, description string, fields []string, fieldFiles []string, gen *Generator) {
+
+	if gen != nil && secret.sources() > 0 {
+		log.Fatal("Use either --generate or a passphrase, not both.")
+	}
 
 	passwardPath := passward.DetectPasswardPath()
 
@@ -20,14 +27,31 @@ func VaultSecretAdd(name string, site string, username string, password string,
 
 	vault := chooseVault(pw, name)
 
-	passphrase := prompt.PasswordMasked("Enter your passphrase to unlock your keys (empty for none)")
-	if err := pw.Unlock(passphrase); err != nil {
-		log.Fatal("Invalid passphrase.", err)
+	const msg = "Enter your passphrase to unlock your keys (empty for none)"
+	if secret.Stdin {
+		unlockPasswardWith(pw, func() string { return readTtyPassphrase(msg) }, vault)
+	} else {
+		unlockPassward(pw, msg, vault)
+	}
+
+	var password string
+	if gen != nil {
+		password = gen.generate()
+	} else {
+		password = secret.read("passphrase")
 	}
 
-	if err := vault.AddEntry(site, username, password, description); err != nil {
+	values := parseFields(fields, fieldFiles)
+	values["username"] = username
+	values["passphrase"] = password
+	values["description"] = description
+
+	if err := vault.SetFields(site, values); err != nil {
 		log.Fatal("Unable to add entry for: "+site, err)
 	}
 
 	fmt.Println("Successfully saved.")
+	if gen != nil && gen.Show {
+		fmt.Println("Generated passphrase: " + password)
+	}
 }
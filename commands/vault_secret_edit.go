@@ -0,0 +1,120 @@
+package commands
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/jandre/passward/passward"
+)
+
+// opens $EDITOR on the decrypted fields of `site`, returning the edited
+// fields and the ones that were deleted.
+func editInEditor(vault *passward.Vault, site string) (map[string]string, []string) {
+	values, err := vault.RevealEntry(site)
+	if err != nil {
+		log.Fatal("Unable to reveal entry for: "+site+" ", err)
+	}
+
+	view := make(map[string]string)
+	for key, val := range values {
+		if !passward.IsHistoryKey(key) {
+			view[key] = val
+		}
+	}
+
+	dir, err := privateTempDir()
+	if err != nil {
+		log.Fatal("Unable to create a temporary directory: ", err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := path.Join(dir, "entry.toml")
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		log.Fatal("Unable to write temporary file: ", err)
+	}
+	err = toml.NewEncoder(f).Encode(view)
+	f.Close()
+	if err != nil {
+		log.Fatal("Unable to write temporary file: ", err)
+	}
+
+	editor := strings.Fields(os.Getenv("EDITOR"))
+	if len(editor) == 0 {
+		editor = []string{"vi"}
+	}
+
+	cmd := exec.Command(editor[0], append(editor[1:], file)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		log.Fatal("Editor exited with an error, nothing was changed. ", err)
+	}
+
+	edited := make(map[string]string)
+	if _, err := toml.DecodeFile(file, &edited); err != nil {
+		log.Fatal("Unable to parse the edited entry, nothing was changed. ", err)
+	}
+
+	removed := make([]string, 0)
+	for key := range view {
+		if _, ok := edited[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+
+	return edited, removed
+}
+
+//
+// VaultSecretEdit changes only the fields that are passed.  With none, the
+// entry is opened in $EDITOR.
+//
+func VaultSecretEdit(name string, site string, username string, password string, description string, fields []string, fieldFiles []string) {
+
+	passwardPath := passward.DetectPasswardPath()
+
+	pw, err := passward.ReadPassward(passwardPath)
+
+	if err != nil {
+		log.Fatal("There was a problem loading the configuration. Did you run `passward setup?`", err)
+	}
+
+	vault := chooseVault(pw, name)
+
+	unlockPassward(pw, "Enter your passphrase to unlock your keys (empty for none)", vault)
+
+	values := parseFields(fields, fieldFiles)
+	if username != "" {
+		values["username"] = username
+	}
+	if password != "" {
+		values["passphrase"] = password
+	}
+	if description != "" {
+		values["description"] = description
+	}
+
+	var removed []string
+	if len(values) == 0 {
+		values, removed = editInEditor(vault, site)
+	}
+
+	changed, err := vault.EditEntry(site, values, removed)
+	if err != nil {
+		log.Fatal("Unable to edit entry for: "+site+" ", err)
+	}
+
+	if len(changed) == 0 {
+		fmt.Println("No changes.")
+		return
+	}
+
+	fmt.Println("Successfully saved. Changed fields: " + strings.Join(changed, ", "))
+}
@@ -0,0 +1,55 @@
+package commands
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/jandre/passward/passward"
+	prompt "github.com/segmentio/go-prompt"
+)
+
+func VaultSecretRemove(name string, site string) {
+
+	passwardPath := passward.DetectPasswardPath()
+
+	pw, err := passward.ReadPassward(passwardPath)
+
+	if err != nil {
+		log.Fatal("There was a problem loading the configuration. Did you run `passward setup?`", err)
+	}
+
+	vault := chooseVault(pw, name)
+
+	unlockPassward(pw, "Enter your passphrase to unlock your keys (empty for none)", vault)
+
+	if !prompt.Confirm(fmt.Sprintf("Are you sure you want to remove the site %s?", site)) {
+		return
+	}
+
+	if err := vault.RemoveEntry(site); err != nil {
+		log.Fatal("Unable to remove entry for: "+site+" ", err)
+	}
+
+	fmt.Printf("Site `%s` removed from vault: %s.\n", site, vault.Name)
+}
+
+func VaultSecretRename(name string, site string, newSite string) {
+
+	passwardPath := passward.DetectPasswardPath()
+
+	pw, err := passward.ReadPassward(passwardPath)
+
+	if err != nil {
+		log.Fatal("There was a problem loading the configuration. Did you run `passward setup?`", err)
+	}
+
+	vault := chooseVault(pw, name)
+
+	unlockPassward(pw, "Enter your passphrase to unlock your keys (empty for none)", vault)
+
+	if err := vault.RenameEntry(site, newSite); err != nil {
+		log.Fatal("Unable to rename entry for: "+site+" ", err)
+	}
+
+	fmt.Printf("Site `%s` renamed to `%s` in vault: %s.\n", site, newSite, vault.Name)
+}
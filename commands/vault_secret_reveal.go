@@ -5,10 +5,9 @@ import (
 	"log"
 
 	"github.com/jandre/passward/passward"
-	"github.com/segmentio/go-prompt"
 )
 
-func VaultSecretReveal(name string, site string) {
+func VaultSecretReveal(name string, site string, history bool) {
 
 	passwardPath := passward.DetectPasswardPath()
 
@@ -20,16 +19,37 @@ func VaultSecretReveal(name string, site string) {
 
 	vault := chooseVault(pw, name)
 
-	passphrase := prompt.PasswordMasked("Enter your passphrase to unlock your keys (empty for none)")
-	if err := pw.Unlock(passphrase); err != nil {
-		log.Fatal("Invalid passphrase.", err)
-	}
+	unlockPassward(pw, "Enter your passphrase to unlock your keys (empty for none)", vault)
 
 	if keys, err := vault.RevealEntry(site); err != nil {
 		log.Fatal("Unable to add entry for: "+site, err)
 	} else {
 		for key, val := range keys {
-			fmt.Printf("%s=%s\n", key, val)
+			if !passward.IsHistoryKey(key) {
+				fmt.Printf("%s=%s\n", key, val)
+			}
+		}
+	}
+
+	if !history {
+		return
+	}
+
+	records, err := vault.EntryHistory(site)
+	if err != nil {
+		log.Fatal("Unable to read history for: "+site+" ", err)
+	}
+
+	fmt.Println()
+	if len(records) == 0 {
+		fmt.Println("No history.")
+	}
+	for _, record := range records {
+		author := record.Author
+		if author == "" {
+			author = "unknown"
 		}
+		fmt.Printf("%s  %s  %s=%s\n", record.When.Local().Format("2006-01-02 15:04:05"), author,
+			record.Field, record.Value)
 	}
 }
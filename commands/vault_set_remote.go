@@ -5,7 +5,6 @@ import (
 	"log"
 
 	"github.com/jandre/passward/passward"
-	"github.com/segmentio/go-prompt"
 )
 
 func VaultSetRemote(name string, url string) {
@@ -24,10 +23,7 @@ func VaultSetRemote(name string, url string) {
 
 	vault := chooseVault(pw, name)
 
-	passphrase := prompt.PasswordMasked("Enter your passphrase to unlock your keys (empty for none)")
-	if err := pw.Unlock(passphrase); err != nil {
-		log.Fatal("Invalid passphrase.", err)
-	}
+	unlockPassward(pw, "Enter your passphrase to unlock your keys (empty for none)", vault)
 
 	err = vault.SetRemote(url)
 	if err != nil {
@@ -3,6 +3,7 @@ package commands
 import (
 	"fmt"
 	"log"
+	"sort"
 
 	"github.com/jandre/passward/passward"
 )
@@ -32,8 +33,24 @@ func VaultShow(name string) {
 
 	}
 
+	// attachment names and sizes are encrypted too
+	hasAttachments := false
+	for _, entry := range vault.Entries() {
+		hasAttachments = hasAttachments || entry.HasAttachments()
+	}
+
+	if vault.EncryptedNames || hasAttachments {
+		unlockPassward(pw, "Site names or attachments are encrypted. Enter your passphrase to unlock your keys (empty for none)", vault)
+		if err := vault.Unlock(); err != nil {
+			log.Fatal("Unable to unlock vault: ", err)
+		}
+	}
+
 	users := vault.Users()
 	fmt.Printf("Showing vault: %s\n", vault.Name)
+	if !vault.LastKeyRotation.IsZero() {
+		fmt.Printf("-- Master key last rotated: %s\n", vault.LastKeyRotation.Format("2006-01-02"))
+	}
 	fmt.Printf("-- Found %d users\n", len(users))
 
 	for _, user := range users {
@@ -43,7 +60,26 @@ func VaultShow(name string) {
 	entries := vault.Entries()
 	fmt.Printf("-- Found %d sites\n", len(entries))
 
-	for _, user := range entries {
-		fmt.Printf("\tSite: %s\n", user.Name())
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		entry := entries[name]
+		fmt.Printf("\tSite: %s\n", entry.Name())
+
+		if !entry.HasAttachments() {
+			continue
+		}
+
+		attachments, err := vault.Attachments(entry.Name())
+		if err != nil {
+			log.Fatal("Unable to read attachments of: "+entry.Name()+" ", err)
+		}
+		for _, attachment := range attachments {
+			fmt.Printf("\t\tAttachment: %s (%s)\n", attachment.Name, formatSize(attachment.Size))
+		}
 	}
 }
@@ -9,7 +9,61 @@ import (
 	"github.com/segmentio/go-prompt"
 )
 
-func VaultSync(name string) {
+// the losing value of "Keep ours" and "Keep theirs" is saved as a history
+// field too
+var resolutionChoices = []string{
+	"Keep ours",
+	"Keep theirs",
+	"Keep both (ours stays current, theirs is saved as a history field, even if one side deleted it)",
+}
+
+func formatConflictValue(val string, deleted bool) string {
+	if deleted {
+		return "(deleted)"
+	}
+	return val
+}
+
+func resolveConflicts(vault *passward.Vault, mergeErr *passward.MergeConflictError) {
+	conflicts, err := vault.RevealConflicts(mergeErr)
+
+	if err != nil {
+		fmt.Println("Unable to merge the remote vault; these files were changed both locally and remotely:")
+		for _, p := range mergeErr.Paths() {
+			fmt.Printf("\t%s\n", p)
+		}
+		fmt.Println("Error is:", err)
+		fmt.Println("The merge was aborted, your local vault is unchanged.")
+		if err := vault.AbortMerge(); err != nil {
+			log.Fatal("Unable to abort merge: ", err)
+		}
+		os.Exit(1)
+	}
+
+	fmt.Printf("Found %d secrets that were changed both locally and remotely.\n", len(conflicts))
+
+	for _, conflict := range conflicts {
+		fmt.Println("")
+		if conflict.Attachment != "" {
+			fmt.Printf("Site: %s, attachment: %s (the side that isn't kept is dropped)\n", conflict.Entry, conflict.Key)
+		} else {
+			fmt.Printf("Site: %s, field: %s\n", conflict.Entry, conflict.Key)
+		}
+		fmt.Printf("\tours:   %s\n", formatConflictValue(conflict.Ours, conflict.OursDeleted))
+		fmt.Printf("\ttheirs: %s\n", formatConflictValue(conflict.Theirs, conflict.TheirsDeleted))
+		conflict.Resolution = passward.Resolution(prompt.Choose("Which value should be kept?", resolutionChoices))
+	}
+
+	if err := vault.ResolveConflicts(conflicts); err != nil {
+		log.Fatal("Unable to resolve conflicts: ", err)
+	}
+}
+
+//
+// VaultSync merges the remote vault and pushes.  With `abort`, it throws
+// away a merge left behind by an earlier sync instead.
+//
+func VaultSync(name string, abort bool) {
 
 	passwardPath := passward.DetectPasswardPath()
 
@@ -21,14 +75,26 @@ func VaultSync(name string) {
 
 	vault := chooseVault(pw, name)
 
-	passphrase := prompt.PasswordMasked("Enter your passphrase to unlock your keys (empty for none)")
-
-	if err := pw.Unlock(passphrase); err != nil {
-		log.Fatal("Invalid passphrase.", err)
+	if abort {
+		vaultSyncAbort(vault)
+		return
 	}
 
+	unlockPassward(pw, "Enter your passphrase to unlock your keys (empty for none)", vault)
+
 	err = vault.Sync()
 
+	if conflict, ok := err.(*passward.MergeConflictError); ok {
+		resolveConflicts(vault, conflict)
+		err = vault.Sync()
+	}
+
+	if sigErr, ok := err.(*passward.SignatureError); ok {
+		fmt.Println("Refusing to sync: the remote vault contains a commit that is not signed by a vault user!")
+		fmt.Println("Error is:", sigErr)
+		os.Exit(1)
+	}
+
 	if err != nil {
 		fmt.Println("Unable to sync vault to remote store, did you call `passward vault set-remote`?")
 		fmt.Println("Error is:", err)
@@ -40,3 +106,20 @@ func VaultSync(name string) {
 
 	fmt.Printf("Vault synced successfully: %s\n", vault.Name)
 }
+
+func vaultSyncAbort(vault *passward.Vault) {
+	merging, err := vault.MergeInProgress()
+	if err != nil {
+		log.Fatal("Unable to read the vault: ", err)
+	}
+
+	if !merging {
+		fmt.Println("No merge is in progress.")
+		return
+	}
+
+	if err := vault.AbortMerge(); err != nil {
+		log.Fatal("Unable to abort merge: ", err)
+	}
+	fmt.Printf("Aborted the merge, vault `%s` is back to its local changes.\n", vault.Name)
+}
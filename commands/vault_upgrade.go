@@ -0,0 +1,38 @@
+package commands
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/jandre/passward/passward"
+)
+
+func VaultUpgrade(name string) {
+
+	passwardPath := passward.DetectPasswardPath()
+
+	pw, err := passward.ReadPassward(passwardPath)
+
+	if err != nil {
+		log.Fatal("There was a problem loading the configuration. Did you run `passward setup?`", err)
+	}
+
+	vault := chooseVault(pw, name)
+
+	unlockPassward(pw, "Enter your passphrase to unlock your keys (empty for none)", vault)
+
+	count, err := vault.Upgrade()
+	if err != nil {
+		log.Fatal("Unable to upgrade vault: ", err)
+	}
+
+	if count == 0 {
+		fmt.Printf("Vault `%s` is up to date.\n", vault.Name)
+	} else {
+		fmt.Printf("Upgraded %d secrets in vault: %s.\n", count, vault.Name)
+	}
+
+	if vault.HasRemote() {
+		fmt.Println("Sync your changes by running `passward vault sync`.")
+	}
+}
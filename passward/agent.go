@@ -0,0 +1,401 @@
+package passward
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"path"
+	"sync"
+	"syscall"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+const agentSocketName = "agent.sock"
+
+// how long a client waits on the agent to connect or answer
+const agentTimeout = 5 * time.Second
+
+// the ssh-agent protocol extension that decrypts with the private key
+const agentDecryptExtension = "decrypt@passward"
+
+// prefixes extension replies, so they can't be mistaken for the
+// SSH_AGENT_FAILURE or SSH_AGENT_EXTENSION_FAILURE codes
+const agentReplySuccess = 6
+
+var errAgentLocked = errors.New("agent is locked")
+
+//
+// AgentSocketPath is the socket of the agent serving `passwardPath`.
+//
+func AgentSocketPath(passwardPath string) string {
+	return path.Join(passwardPath, agentSocketName)
+}
+
+//
+// Agent keeps the keys of `creds` unlocked in memory, so commands don't
+// have to ask for the passphrase every time.  It speaks the ssh-agent
+// protocol, so git can use it to reach ssh remotes, and decrypts through
+// the `decrypt@passward` extension; neither the passphrase nor the private
+// key ever leave it.  Only the owner of the socket can connect to it, and
+// the keys are forgotten after `idleTimeout` without a request.
+//
+type Agent struct {
+	socketPath  string
+	creds       *Credentials
+	idleTimeout time.Duration
+
+	// the clock, replaced in tests
+	now func() time.Time
+
+	mu        sync.Mutex
+	keyring   *SshKeyRing
+	keys      agent.Agent
+	lastUsed  time.Time
+	idleTimer *time.Timer
+	listener  net.Listener
+}
+
+func NewAgent(passwardPath string, creds *Credentials, idleTimeout time.Duration) *Agent {
+	return &Agent{
+		socketPath:  AgentSocketPath(passwardPath),
+		creds:       creds,
+		idleTimeout: idleTimeout,
+		now:         time.Now,
+	}
+}
+
+// forgets the keys; the caller holds `a.mu`
+func (a *Agent) lock() {
+	a.keyring = nil
+	a.keys = nil
+	if a.idleTimer != nil {
+		a.idleTimer.Stop()
+		a.idleTimer = nil
+	}
+}
+
+// marks the keys as used, starting the idle countdown if it isn't running;
+// the caller holds `a.mu`
+func (a *Agent) touch() {
+	if a.idleTimeout <= 0 || a.keyring == nil {
+		return
+	}
+	a.lastUsed = a.now()
+	if a.idleTimer == nil {
+		a.idleTimer = time.AfterFunc(a.idleTimeout, a.onIdle)
+	}
+}
+
+func (a *Agent) onIdle() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.idleTimer = nil
+	a.expire()
+}
+
+// forgets the keys if they haven't been used for `idleTimeout`, or else
+// checks again when they would be; the caller holds `a.mu`
+func (a *Agent) expire() {
+	if a.idleTimeout <= 0 || a.keyring == nil {
+		return
+	}
+
+	idle := a.now().Sub(a.lastUsed)
+	if idle < a.idleTimeout {
+		if a.idleTimer == nil {
+			a.idleTimer = time.AfterFunc(a.idleTimeout-idle, a.onIdle)
+		}
+		return
+	}
+
+	debug("agent idle, locking")
+	a.lock()
+}
+
+//
+// Unlock checks `passphrase` against the private key, and keeps the
+// unlocked key.
+//
+func (a *Agent) Unlock(passphrase string) error {
+	keyring, err := NewSshKeyRing(a.creds.PublicKeyPath, a.creds.PrivateKeyPath, passphrase)
+	if err != nil {
+		return err
+	}
+
+	keys := agent.NewKeyring()
+	if err := keys.Add(agent.AddedKey{PrivateKey: keyring.rawPrivateKey, Comment: a.creds.Email}); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.keyring = keyring
+	a.keys = keys
+	a.touch()
+	return nil
+}
+
+// the unlocked keys, which counts as using them
+func (a *Agent) unlocked() (*SshKeyRing, agent.Agent, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.keyring == nil {
+		return nil, nil, errAgentLocked
+	}
+	a.touch()
+	return a.keyring, a.keys, nil
+}
+
+//
+// agentServer answers the ssh-agent protocol for an Agent.  Keys can't be
+// added or removed; removing all of them, or locking, forgets them.
+//
+type agentServer struct {
+	agent *Agent
+}
+
+func (s *agentServer) List() ([]*agent.Key, error) {
+	_, keys, err := s.agent.unlocked()
+	if err == errAgentLocked {
+		return []*agent.Key{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return keys.List()
+}
+
+func (s *agentServer) Sign(key gossh.PublicKey, data []byte) (*gossh.Signature, error) {
+	return s.SignWithFlags(key, data, 0)
+}
+
+func (s *agentServer) SignWithFlags(key gossh.PublicKey, data []byte, flags agent.SignatureFlags) (*gossh.Signature, error) {
+	_, keys, err := s.agent.unlocked()
+	if err != nil {
+		return nil, err
+	}
+	return keys.(agent.ExtendedAgent).SignWithFlags(key, data, flags)
+}
+
+func (s *agentServer) Signers() ([]gossh.Signer, error) {
+	_, keys, err := s.agent.unlocked()
+	if err != nil {
+		return nil, err
+	}
+	return keys.Signers()
+}
+
+func (s *agentServer) Add(key agent.AddedKey) error {
+	return errors.New("keys can't be added to the passward agent")
+}
+
+func (s *agentServer) Remove(key gossh.PublicKey) error {
+	return errors.New("keys can't be removed from the passward agent; lock it instead")
+}
+
+func (s *agentServer) RemoveAll() error {
+	return s.Lock(nil)
+}
+
+func (s *agentServer) Lock(passphrase []byte) error {
+	s.agent.mu.Lock()
+	defer s.agent.mu.Unlock()
+	s.agent.lock()
+	return nil
+}
+
+func (s *agentServer) Unlock(passphrase []byte) error {
+	return s.agent.Unlock(string(passphrase))
+}
+
+func (s *agentServer) Extension(extensionType string, contents []byte) ([]byte, error) {
+	if extensionType != agentDecryptExtension {
+		return nil, agent.ErrExtensionUnsupported
+	}
+
+	keyring, _, err := s.agent.unlocked()
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := keyring.privateKey.DecryptBytes(contents)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{agentReplySuccess}, plain...), nil
+}
+
+func (a *Agent) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	if err := agent.ServeAgent(&agentServer{agent: a}, conn); err != nil {
+		debug("agent connection closed", err)
+	}
+}
+
+//
+// Listen creates the socket, readable by its owner only.  It fails if
+// another agent is already running.
+//
+func (a *Agent) Listen() error {
+	if AgentRunning(path.Dir(a.socketPath)) {
+		return errors.New("An agent is already running on: " + a.socketPath)
+	}
+
+	// a leftover from an agent that didn't exit cleanly
+	os.Remove(a.socketPath)
+
+	old := syscall.Umask(0177)
+	listener, err := net.Listen("unix", a.socketPath)
+	syscall.Umask(old)
+	if err != nil {
+		return err
+	}
+
+	a.listener = listener
+	return nil
+}
+
+//
+// Serve answers requests until `Close` is called.
+//
+func (a *Agent) Serve() error {
+	for {
+		conn, err := a.listener.Accept()
+		if err != nil {
+			return err
+		}
+		go a.serveConn(conn)
+	}
+}
+
+//
+// Close forgets the keys and removes the socket.
+//
+func (a *Agent) Close() error {
+	a.mu.Lock()
+	a.lock()
+	a.mu.Unlock()
+
+	if a.listener == nil {
+		return nil
+	}
+	return a.listener.Close()
+}
+
+// connects to the agent serving `passwardPath`
+func dialAgent(passwardPath string) (net.Conn, agent.ExtendedAgent, error) {
+	conn, err := net.DialTimeout("unix", AgentSocketPath(passwardPath), agentTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, agent.NewClient(conn), nil
+}
+
+// runs a single request against the agent serving `passwardPath`
+func agentCall(passwardPath string, call func(agent.ExtendedAgent) error) error {
+	conn, client, err := dialAgent(passwardPath)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(agentTimeout))
+
+	return call(client)
+}
+
+//
+// AgentRunning returns true if an agent answers on the socket of
+// `passwardPath`.
+//
+func AgentRunning(passwardPath string) bool {
+	return agentCall(passwardPath, func(client agent.ExtendedAgent) error {
+		_, err := client.List()
+		return err
+	}) == nil
+}
+
+//
+// AgentUnlock hands `passphrase` to the running agent, to unlock its keys.
+//
+func AgentUnlock(passwardPath string, passphrase string) error {
+	return agentCall(passwardPath, func(client agent.ExtendedAgent) error {
+		return client.Unlock([]byte(passphrase))
+	})
+}
+
+//
+// AgentLock makes the running agent forget the keys.
+//
+func AgentLock(passwardPath string) error {
+	return agentCall(passwardPath, func(client agent.ExtendedAgent) error {
+		return client.Lock(nil)
+	})
+}
+
+//
+// agentDecrypter decrypts with the private key held by the agent.
+//
+type agentDecrypter struct {
+	client agent.ExtendedAgent
+}
+
+func (d *agentDecrypter) DecryptBytes(data []byte) ([]byte, error) {
+	reply, err := d.client.Extension(agentDecryptExtension, data)
+	if err != nil {
+		return nil, err
+	}
+	if len(reply) == 0 || reply[0] != agentReplySuccess {
+		return nil, errors.New("Unexpected reply from the agent")
+	}
+	return reply[1:], nil
+}
+
+//
+// NewAgentKeyRing builds a key ring whose private key stays in the
+// running, unlocked agent of `passwardPath`.  It signs and decrypts
+// through the agent.
+//
+func NewAgentKeyRing(passwardPath string, publicKeyPath string) (*SshKeyRing, error) {
+	ssh := SshKeyRing{PublicKeyPath: publicKeyPath}
+
+	if err := ssh.ParsePublicKey(); err != nil {
+		return nil, err
+	}
+
+	key, _, _, _, err := gossh.ParseAuthorizedKey([]byte(ssh.publicKeyString))
+	if err != nil {
+		return nil, err
+	}
+
+	conn, client, err := dialAgent(passwardPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// the connection stays open for as long as the key ring is used.
+	signers, err := client.Signers()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	for _, signer := range signers {
+		if bytes.Equal(signer.PublicKey().Marshal(), key.Marshal()) {
+			ssh.signer = signer
+		}
+	}
+
+	if ssh.signer == nil {
+		conn.Close()
+		return nil, errors.New("The agent is locked")
+	}
+
+	ssh.privateKey = &agentDecrypter{client: client}
+	ssh.agentSocket = AgentSocketPath(passwardPath)
+	return &ssh, nil
+}
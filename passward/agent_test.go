@@ -0,0 +1,114 @@
+package passward
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestAgent(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	creds := testCredentials(t, dir, "me@example.com", "secret")
+	creds.Lock()
+
+	agent := NewAgent(dir, creds, time.Hour)
+	if err := agent.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	defer agent.Close()
+	go agent.Serve()
+
+	stat, err := os.Stat(AgentSocketPath(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Mode().Perm() != 0600 {
+		t.Fatal("expected a private socket, got:", stat.Mode())
+	}
+
+	if !AgentRunning(dir) {
+		t.Fatal("expected the agent to answer")
+	}
+	if _, err := NewAgentKeyRing(dir, creds.PublicKeyPath); err == nil {
+		t.Fatal("expected a new agent to be locked")
+	}
+
+	if err := AgentUnlock(dir, "wrong"); err == nil {
+		t.Fatal("expected a wrong passphrase to fail")
+	}
+	if err := AgentUnlock(dir, "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := NewAgentKeyRing(dir, creds.PublicKeyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := keys.EncryptAndBase64([]byte("master key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := keys.DecryptBase64(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decrypted) != "master key" {
+		t.Fatal("mismatch:", string(decrypted))
+	}
+
+	signature, err := keys.Sign([]byte("commit"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifySshSignature(creds.PublicKeyString(), []byte("commit"), signature); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := AgentLock(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.DecryptBase64(encrypted); err == nil {
+		t.Fatal("expected the agent to be locked")
+	}
+
+	// the idle timeout, on a clock the test controls; the agent reads it
+	// while holding its lock
+	clock := time.Now()
+	agent.mu.Lock()
+	agent.now = func() time.Time { return clock }
+	agent.mu.Unlock()
+
+	idle := func(d time.Duration) {
+		agent.mu.Lock()
+		defer agent.mu.Unlock()
+		clock = clock.Add(d)
+		agent.expire()
+	}
+
+	if err := AgentUnlock(dir, "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	idle(59 * time.Minute)
+	if _, err := keys.DecryptBase64(encrypted); err != nil {
+		t.Fatal("expected the agent to be unlocked:", err)
+	}
+
+	idle(59 * time.Minute)
+	if _, err := keys.DecryptBase64(encrypted); err != nil {
+		t.Fatal("expected use to restart the idle timeout:", err)
+	}
+
+	idle(time.Hour)
+	if _, err := keys.DecryptBase64(encrypted); err == nil {
+		t.Fatal("expected the agent to lock when idle")
+	}
+}
@@ -9,6 +9,9 @@ type Credentials struct {
 	Email          string
 	PublicKeyPath  string
 	PrivateKeyPath string
+
+	// unlock through ssh-agent when it holds the key, see ssh_agent.go
+	SshAgent bool
 }
 
 func (creds *Credentials) PublicKeyString() string {
@@ -56,3 +59,55 @@ func (creds *Credentials) Unlock(passphrase string) error {
 func (creds *Credentials) IsUnlocked() bool {
 	return creds.keyring != nil
 }
+
+//
+// UnlockWithSshAgent unlocks the keys with the private key held by
+// ssh-agent instead of the private key file.
+//
+func (creds *Credentials) UnlockWithSshAgent() error {
+	if creds.keyring != nil {
+		return nil
+	}
+
+	keyring, err := NewSshAgentKeyRing(creds.PublicKeyPath)
+	if err != nil {
+		return err
+	}
+	creds.keyring = keyring
+	return nil
+}
+
+//
+// UnlockWithAgent unlocks the keys with the private key held by the
+// running passward agent of `passwardPath`, see agent.go.
+//
+func (creds *Credentials) UnlockWithAgent(passwardPath string) error {
+	if creds.keyring != nil {
+		return nil
+	}
+
+	keyring, err := NewAgentKeyRing(passwardPath, creds.PublicKeyPath)
+	if err != nil {
+		return err
+	}
+	creds.keyring = keyring
+	return nil
+}
+
+//
+// AgentSocket returns the ssh-agent protocol socket holding the private
+// key, or "" if the keys were unlocked with the private key file.
+//
+func (creds *Credentials) AgentSocket() string {
+	if creds.keyring == nil {
+		return ""
+	}
+	return creds.keyring.AgentSocket()
+}
+
+//
+// UsesSshAgent returns true if the keys were unlocked through ssh-agent.
+//
+func (creds *Credentials) UsesSshAgent() bool {
+	return creds.keyring != nil && creds.keyring.FromSshAgent()
+}
@@ -11,6 +11,10 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
 )
 
 func SignData(passphrase string, data string) string {
@@ -27,16 +31,45 @@ func VerifySignature(passphrase string, data string, expected string) bool {
 	return hmac.Equal(b1, b2)
 }
 
+//
+// Ciphertext envelope versions.  Versions 1 and 2 are:
+//
+//   <1 byte version><16 byte salt><12 byte nonce><aes-256-gcm ciphertext>
+//
+// where the AES key is derived from the passphrase and salt with HKDF-SHA256.
+// Version 2 also authenticates associated data, so a ciphertext only opens
+// in the place it was written for.
+//
+// Legacy ciphertexts have no header; they are <12 byte nonce><aes-128-gcm
+// ciphertext> keyed with `KeyGen`.  They can still be decrypted, and are
+// rewritten by `passward vault upgrade`.
+//
+const (
+	CipherVersionLegacy byte = 0
+	CipherVersion1      byte = 1
+	CipherVersion2      byte = 2
+
+	CurrentCipherVersion = CipherVersion2
+)
+
+const (
+	saltSize   = 16
+	aes256Size = 32
+	hkdfInfo   = "passward v1 aes-256-gcm"
+)
+
 //
 // KeyGen() will generate a key with a passphrase that is `keySize` bytes
 // in length.
 //
+// It is only used to read legacy ciphertexts; new ciphertexts use `DeriveKey`.
+//
 func KeyGen(passphrase string, keySize uint) ([]byte, error) {
 
 	// there's too many bytes requested
 	// TODO: can generate multi-hashes
 	if keySize > sha256.Size {
-		return nil, errors.New("key size is too large: " + string(keySize))
+		return nil, fmt.Errorf("key size is too large: %d", keySize)
 	}
 
 	// it's an n byte key, so let's generate a cryptographic hash of the passphrase and
@@ -45,6 +78,20 @@ func KeyGen(passphrase string, keySize uint) ([]byte, error) {
 	return bytes[:keySize], nil
 }
 
+//
+// DeriveKey() derives a `keySize` byte key from `passphrase` and `salt` with
+// HKDF-SHA256.  The passphrase is the random vault master key, so a
+// memory-hard KDF is not needed.
+//
+func DeriveKey(passphrase string, salt []byte, keySize int) ([]byte, error) {
+	key := make([]byte, keySize)
+	kdf := hkdf.New(sha256.New, []byte(passphrase), salt, []byte(hkdfInfo))
+	if _, err := io.ReadFull(kdf, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
 //
 // GenRandomIv() will generate random IV of `blockSize` bytes.
 //
@@ -63,25 +110,45 @@ func GenRandomIv(blockSize int) ([]byte, error) {
 	return b, nil
 }
 
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
 //
 // Encrypts a block with the given passphrase.
 //
-// Returns a byte block with <32 byte sha-256 hmac>< blockSize iv>< n blocks payload>
+// Returns a version 2 envelope: <version><salt><nonce><payload>
+//
 func Encrypt(passphrase string, bytes []byte) ([]byte, error) {
+	return EncryptWithAD(passphrase, bytes, nil)
+}
 
-	key, err := KeyGen(passphrase, aes.BlockSize)
+//
+// EncryptWithAD encrypts a block with the given passphrase, and
+// authenticates the associated data `ad` along with it.  The same `ad`
+// must be passed to `DecryptWithAD`.
+//
+func EncryptWithAD(passphrase string, bytes []byte, ad []byte) ([]byte, error) {
+
+	salt, err := GenRandomIv(saltSize)
 
 	if err != nil {
 		return nil, err
 	}
 
-	aes, err := aes.NewCipher(key)
+	key, err := DeriveKey(passphrase, salt, aes256Size)
 
 	if err != nil {
 		return nil, err
 	}
 
-	mode, err := cipher.NewGCM(aes)
+	mode, err := newGCM(key)
 
 	if err != nil {
 		return nil, err
@@ -93,42 +160,126 @@ func Encrypt(passphrase string, bytes []byte) ([]byte, error) {
 		return nil, err
 	}
 
+	header := make([]byte, 0, 1+len(salt)+len(iv))
+	header = append(header, CipherVersion2)
+	header = append(header, salt...)
+	header = append(header, iv...)
+
+	return mode.Seal(header, iv, bytes, ad), nil
+}
+
+// opens a version 1 or 2 envelope
+func openEnvelope(passphrase string, data []byte, ad []byte) ([]byte, error) {
+	if len(data) < 1+saltSize {
+		return nil, errors.New("ciphertext is too short")
+	}
+
+	salt := data[1 : 1+saltSize]
+	key, err := DeriveKey(passphrase, salt, aes256Size)
+
 	if err != nil {
 		return nil, err
 	}
 
-	encrypted := mode.Seal(nil, iv, bytes, nil)
+	mode, err := newGCM(key)
 
-	result := append(iv, encrypted...)
+	if err != nil {
+		return nil, err
+	}
 
-	return result, nil
-}
+	data = data[1+saltSize:]
+	if len(data) < mode.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
 
-func Decrypt(passphrase string, data []byte) ([]byte, error) {
+	iv := data[:mode.NonceSize()]
+	return mode.Open(nil, iv, data[mode.NonceSize():], ad)
+}
 
+func decryptLegacy(passphrase string, data []byte) ([]byte, error) {
 	key, err := KeyGen(passphrase, aes.BlockSize)
 
 	if err != nil {
 		return nil, err
 	}
 
-	aes, err := aes.NewCipher(key)
+	mode, err := newGCM(key)
 
 	if err != nil {
 		return nil, err
 	}
 
-	mode, err := cipher.NewGCM(aes)
-	ivBytesSize := mode.NonceSize()
-	iv := data[:ivBytesSize]
-	cipherText := data[ivBytesSize:]
+	if len(data) < mode.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
 
-	if err != nil {
-		return nil, err
+	iv := data[:mode.NonceSize()]
+	return mode.Open(nil, iv, data[mode.NonceSize():], nil)
+}
+
+//
+// DecryptVersion decrypts `data` and returns the envelope version it was
+// stored in.
+//
+func DecryptVersion(passphrase string, data []byte) ([]byte, byte, error) {
+	return DecryptWithAD(passphrase, data, nil)
+}
+
+//
+// DecryptWithAD decrypts `data`, checking the associated data `ad` if the
+// envelope carries it, and returns the envelope version it was stored in.
+//
+// On failure, the version returned is the one claimed by the header.
+//
+func DecryptWithAD(passphrase string, data []byte, ad []byte) ([]byte, byte, error) {
+	return DecryptMinVersion(passphrase, data, ad, CipherVersionLegacy)
+}
+
+//
+// DecryptMinVersion is `DecryptWithAD`, but rejects envelopes older than
+// `minVersion`.  Upgraded vaults use it, so that an older ciphertext, which
+// doesn't authenticate where it is stored, can't be swapped in.
+//
+func DecryptMinVersion(passphrase string, data []byte, ad []byte, minVersion byte) ([]byte, byte, error) {
+	claimed := CipherVersionLegacy
+
+	if len(data) > 0 {
+		switch data[0] {
+		case CipherVersion1:
+			claimed = CipherVersion1
+			ad = nil
+		case CipherVersion2:
+			claimed = CipherVersion2
+		}
+	}
+
+	if claimed < minVersion {
+		return nil, claimed, fmt.Errorf("ciphertext version %d is older than the required version %d", claimed, minVersion)
+	}
+
+	if claimed != CipherVersionLegacy {
+		result, err := openEnvelope(passphrase, data, ad)
+		if err == nil {
+			return result, claimed, nil
+		}
+		if minVersion != CipherVersionLegacy {
+			return nil, claimed, err
+		}
 	}
 
-	return mode.Open(nil, iv, cipherText, nil)
+	// a legacy nonce can start with a version byte by chance, so fall
+	// back to the legacy format if the envelope doesn't open.
 
+	result, err := decryptLegacy(passphrase, data)
+	if err != nil {
+		return nil, claimed, err
+	}
+	return result, CipherVersionLegacy, nil
+}
+
+func Decrypt(passphrase string, data []byte) ([]byte, error) {
+	result, _, err := DecryptVersion(passphrase, data)
+	return result, err
 }
 
 //
@@ -169,3 +320,15 @@ func EncryptAndBase64String(passphrase string, data string) (string, error) {
 	}
 	return base64.StdEncoding.EncodeToString(result), nil
 }
+
+//
+// EncryptAndBase64StringWithAD is `EncryptAndBase64String` with associated
+// data.
+//
+func EncryptAndBase64StringWithAD(passphrase string, data string, ad []byte) (string, error) {
+	result, err := EncryptWithAD(passphrase, []byte(data), ad)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(result), nil
+}
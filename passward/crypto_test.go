@@ -1,6 +1,7 @@
 package passward
 
 import (
+	"crypto/aes"
 	"testing"
 )
 
@@ -25,3 +26,89 @@ func TestEncryptDecrypt(t *testing.T) {
 		t.Fatal("mismatch:", cleartext, secret)
 	}
 }
+
+func TestEncryptVersion(t *testing.T) {
+
+	passphrase := "my secret passphrase"
+
+	ciphertext, err := EncryptString(passphrase, "secret")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ciphertext[0] != CurrentCipherVersion {
+		t.Fatal("unexpected version:", ciphertext[0])
+	}
+
+	_, version, err := DecryptVersion(passphrase, ciphertext)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version != CurrentCipherVersion {
+		t.Fatal("unexpected version:", version)
+	}
+}
+
+func TestDecryptLegacy(t *testing.T) {
+
+	passphrase := "my secret passphrase"
+	secret := "secret"
+
+	key, err := KeyGen(passphrase, aes.BlockSize)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mode, err := newGCM(key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iv, err := GenRandomIv(mode.NonceSize())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	legacy := mode.Seal(iv, iv, []byte(secret), nil)
+
+	cleartext, version, err := DecryptVersion(passphrase, legacy)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(cleartext) != secret {
+		t.Fatal("mismatch:", string(cleartext), secret)
+	}
+
+	if version != CipherVersionLegacy {
+		t.Fatal("unexpected version:", version)
+	}
+}
+
+func TestDecryptWithAD(t *testing.T) {
+
+	passphrase := "my secret passphrase"
+
+	ciphertext, err := EncryptWithAD(passphrase, []byte("secret"), []byte("vault\x00site\x00passphrase"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, version, err := DecryptWithAD(passphrase, ciphertext, []byte("vault\x00other\x00passphrase"))
+
+	if err == nil {
+		t.Fatal("expected associated data mismatch to fail")
+	}
+
+	if version != CipherVersion2 {
+		t.Fatal("unexpected version:", version)
+	}
+}
@@ -0,0 +1,98 @@
+package passward
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+)
+
+// separates a field name from the timestamp of one of its history fields
+const historySeparator = ".history."
+
+// layouts of the timestamp suffix of history fields, newest first
+const historyTimeFormat = "20060102T150405.000000000Z"
+const legacyHistoryTimeFormat = "20060102T150405Z"
+
+//
+// HistoryRecord is an earlier value of a field of an entry.
+//
+type HistoryRecord struct {
+	Field  string
+	Value  string
+	Author string
+	When   time.Time
+}
+
+// the encrypted contents of a history field
+type historyValue struct {
+	Value  string    `json:"value"`
+	Author string    `json:"author"`
+	When   time.Time `json:"when"`
+}
+
+// keeps `val`, the value `key` had until `when`, as a history record
+func (e *Entry) addHistory(key string, val string, author string, when time.Time, encryptionKey []byte) error {
+	bytes, err := json.Marshal(historyValue{Value: val, Author: author, When: when.UTC()})
+	if err != nil {
+		return err
+	}
+	return e.set(historyKey(key, when), string(bytes), encryptionKey)
+}
+
+// reads the history field `key`.  Records written before authors were
+// tracked hold the bare value, and take their time from the field name.
+func (e *Entry) readHistory(key string, encryptionKey []byte) (*HistoryRecord, error) {
+	idx := strings.LastIndex(key, historySeparator)
+	field, stamp := key[:idx], key[idx+len(historySeparator):]
+
+	val, err := e.Reveal(key, encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var stored historyValue
+	if err := json.Unmarshal([]byte(val), &stored); err == nil {
+		return &HistoryRecord{Field: field, Value: stored.Value, Author: stored.Author, When: stored.When}, nil
+	}
+
+	when, err := time.Parse(historyTimeFormat, stamp)
+	if err != nil {
+		when, _ = time.Parse(legacyHistoryTimeFormat, stamp)
+	}
+	return &HistoryRecord{Field: field, Value: val, When: when}, nil
+}
+
+//
+// History returns the earlier values of every field of the entry, newest
+// first.
+//
+func (e *Entry) History(encryptionKey []byte) ([]HistoryRecord, error) {
+	records := make([]HistoryRecord, 0)
+
+	for key := range e.encryptedValues {
+		if !IsHistoryKey(key) {
+			continue
+		}
+
+		record, err := e.readHistory(key, encryptionKey)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, *record)
+	}
+
+	sort.Sort(newestFirst(records))
+	return records, nil
+}
+
+type newestFirst []HistoryRecord
+
+func (r newestFirst) Len() int      { return len(r) }
+func (r newestFirst) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r newestFirst) Less(i, j int) bool {
+	if r[i].When.Equal(r[j].When) {
+		return r[i].Field < r[j].Field
+	}
+	return r[i].When.After(r[j].When)
+}
@@ -0,0 +1,185 @@
+package passward
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+const (
+	LowerChars     = "abcdefghijklmnopqrstuvwxyz"
+	UpperChars     = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	DigitChars     = "0123456789"
+	SymbolChars    = "!#$%&()*+,-./:;<=>?@[]^_{}~"
+	AmbiguousChars = "Il1O0o"
+)
+
+// MinPassphraseBits is the least entropy `GeneratePassphrase` and
+// `GeneratePassword` will produce.
+const MinPassphraseBits = 64
+
+//
+// GenerateOptions controls the characters `GeneratePassword` picks from.
+// Every enabled class is used at least once.
+//
+type GenerateOptions struct {
+	Length           int
+	Lower            bool
+	Upper            bool
+	Digits           bool
+	Symbols          bool
+	ExcludeAmbiguous bool
+}
+
+// returns a uniformly random int in [0, max) read from crypto/rand
+func randomIndex(max int) (int, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(max)))
+	if err != nil {
+		return 0, err
+	}
+	return int(n.Int64()), nil
+}
+
+func withoutAmbiguous(chars string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(AmbiguousChars, r) {
+			return -1
+		}
+		return r
+	}, chars)
+}
+
+//
+// MinPasswordLength returns how many characters picked from `chars`
+// distinct ones a password needs to have `MinPassphraseBits` of entropy.
+//
+func MinPasswordLength(chars int) int {
+	if chars < 2 {
+		return 0
+	}
+	return int(math.Ceil(MinPassphraseBits / math.Log2(float64(chars))))
+}
+
+//
+// GeneratePassword returns a random password of `opts.Length` characters.
+// Passwords with less than `MinPassphraseBits` of entropy are refused.
+//
+func GeneratePassword(opts GenerateOptions) (string, error) {
+	classes := make([]string, 0, 4)
+	for _, class := range []struct {
+		enabled bool
+		chars   string
+	}{
+		{opts.Lower, LowerChars},
+		{opts.Upper, UpperChars},
+		{opts.Digits, DigitChars},
+		{opts.Symbols, SymbolChars},
+	} {
+		if !class.enabled {
+			continue
+		}
+		if opts.ExcludeAmbiguous {
+			class.chars = withoutAmbiguous(class.chars)
+		}
+		classes = append(classes, class.chars)
+	}
+
+	if len(classes) == 0 {
+		return "", errors.New("At least one character class is required.")
+	}
+	// the classes don't overlap, so every character of `all` is distinct
+	all := strings.Join(classes, "")
+	if min := MinPasswordLength(len(all)); opts.Length < min {
+		return "", fmt.Errorf("%d characters from a set of %d are too easy to guess; use at least %d.",
+			opts.Length, len(all), min)
+	}
+
+	password := make([]byte, opts.Length)
+
+	// pick from every class, then retry until each one is used; this
+	// keeps every password of the given shape equally likely.
+	for {
+		for i := range password {
+			idx, err := randomIndex(len(all))
+			if err != nil {
+				return "", err
+			}
+			password[i] = all[idx]
+		}
+
+		if usesEveryClass(string(password), classes) {
+			return string(password), nil
+		}
+	}
+}
+
+func usesEveryClass(password string, classes []string) bool {
+	for _, chars := range classes {
+		if !strings.ContainsAny(password, chars) {
+			return false
+		}
+	}
+	return true
+}
+
+// returns the words of `list` without repeats, so each is equally likely
+func distinctWords(list []string) []string {
+	seen := make(map[string]bool, len(list))
+	words := make([]string, 0, len(list))
+	for _, word := range list {
+		if !seen[word] {
+			seen[word] = true
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+//
+// MinPassphraseWords returns how many words from `list` a passphrase needs
+// to have `MinPassphraseBits` of entropy.  If `list` is nil, the built-in
+// list is used.
+//
+func MinPassphraseWords(list []string) int {
+	if list == nil {
+		list = wordList
+	}
+	size := len(distinctWords(list))
+	if size < 2 {
+		return 0
+	}
+	return int(math.Ceil(MinPassphraseBits / math.Log2(float64(size))))
+}
+
+//
+// GeneratePassphrase returns `words` random words from `list`, joined by
+// `separator`.  If `list` is nil, a built-in list is used.  Passphrases with
+// less than `MinPassphraseBits` of entropy are refused.
+//
+func GeneratePassphrase(words int, separator string, list []string) (string, error) {
+	if list == nil {
+		list = wordList
+	}
+	list = distinctWords(list)
+	if len(list) < 2 {
+		return "", errors.New("The word list needs at least two distinct words.")
+	}
+	if min := MinPassphraseWords(list); words < min {
+		return "", fmt.Errorf("%d words from a list of %d are too easy to guess; use at least %d.",
+			words, len(list), min)
+	}
+
+	chosen := make([]string, words)
+	for i := range chosen {
+		idx, err := randomIndex(len(list))
+		if err != nil {
+			return "", err
+		}
+		chosen[i] = list[idx]
+	}
+
+	return strings.Join(chosen, separator), nil
+}
@@ -0,0 +1,94 @@
+package passward
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestGeneratePassword(t *testing.T) {
+
+	opts := GenerateOptions{Length: 14, Lower: true, Digits: true, ExcludeAmbiguous: true}
+
+	for i := 0; i < 50; i++ {
+		password, err := GeneratePassword(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(password) != 14 {
+			t.Fatal("unexpected length:", password)
+		}
+		if !strings.ContainsAny(password, DigitChars) || !strings.ContainsAny(password, LowerChars) {
+			t.Fatal("expected every class in:", password)
+		}
+		if strings.ContainsAny(password, AmbiguousChars+UpperChars+SymbolChars) {
+			t.Fatal("unexpected characters in:", password)
+		}
+	}
+
+	if _, err := GeneratePassword(GenerateOptions{Length: 2, Lower: true, Upper: true, Digits: true}); err == nil {
+		t.Fatal("expected length shorter than the classes to fail")
+	}
+}
+
+func TestGeneratePasswordEntropy(t *testing.T) {
+
+	// 34 characters: lower case and digits, without the ambiguous ones
+	opts := GenerateOptions{Lower: true, Digits: true, ExcludeAmbiguous: true}
+	min := MinPasswordLength(34)
+	if bits := float64(min) * math.Log2(34); bits < MinPassphraseBits {
+		t.Fatal("expected at least", MinPassphraseBits, "bits, got:", bits)
+	}
+
+	opts.Length = min
+	if _, err := GeneratePassword(opts); err != nil {
+		t.Fatal(err)
+	}
+
+	opts.Length = min - 1
+	if _, err := GeneratePassword(opts); err == nil {
+		t.Fatal("expected a password with too little entropy to fail")
+	}
+
+	// the default length of `secret add` is enough with any single class
+	for _, opts := range []GenerateOptions{
+		{Length: 20, Lower: true},
+		{Length: 20, Upper: true},
+		{Length: 20, Digits: true},
+		{Length: 20, Symbols: true},
+	} {
+		if _, err := GeneratePassword(opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGeneratePassphrase(t *testing.T) {
+
+	min := MinPassphraseWords(nil)
+	if bits := float64(min) * math.Log2(float64(len(wordList))); bits < MinPassphraseBits {
+		t.Fatal("expected at least", MinPassphraseBits, "bits, got:", bits)
+	}
+
+	passphrase, err := GeneratePassphrase(min, "-", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if words := strings.Split(passphrase, "-"); len(words) != min {
+		t.Fatal("expected", min, "words:", passphrase)
+	}
+
+	if _, err := GeneratePassphrase(min-1, "-", nil); err == nil {
+		t.Fatal("expected too few words to fail")
+	}
+
+	// repeated words add no entropy
+	if _, err := GeneratePassphrase(64, "-", []string{"a", "b", "b", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GeneratePassphrase(63, "-", []string{"a", "b", "b", "b"}); err == nil {
+		t.Fatal("expected repeated words not to count")
+	}
+}
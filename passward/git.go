@@ -2,8 +2,10 @@ package passward
 
 import (
 	"errors"
+	"os"
 	"path"
 	"regexp"
+	"strings"
 	"time"
 
 	pb "github.com/cheggaaa/pb"
@@ -32,19 +34,72 @@ func detectGitName(url string) string {
 type Git struct {
 	path        string
 	credentials *Credentials
+	knownHosts  *KnownHosts
 	repo        *git2go.Repository
 	progressBar *pb.ProgressBar
+
+	// the url being cloned, fetched or pushed, for the port of its host
+	remoteUrl string
+
+	// set when the last certificate check failed, so the caller sees why
+	certErr error
 }
 
 var instance *Git
 
+//
+// ErrMergeInProgress is returned when a change would be committed on top of
+// a merge that was left unfinished, e.g. when conflict resolution was
+// interrupted.
+//
+var ErrMergeInProgress = errors.New("A merge with the remote is unfinished, run `passward vault sync` to resolve it, or `passward vault sync --abort` to throw it away.")
+
+//
+// MergeConflict holds both sides of a file that was changed locally and
+// remotely, and the version they both started from.  A side is empty if
+// that side deleted the file, or if the file didn't exist in the ancestor.
+//
+type MergeConflict struct {
+	Path     string
+	Ancestor string
+	Ours     string
+	Theirs   string
+}
+
+//
+// MergeConflictError is returned by `Pull` when the local and remote
+// histories both changed the same files in the vault.  The repository is
+// left mid-merge until the conflicts are committed or `AbortMerge` is called.
+//
+type MergeConflictError struct {
+	Conflicts []*MergeConflict
+}
+
+func (e *MergeConflictError) Paths() []string {
+	paths := make([]string, len(e.Conflicts))
+	for i, conflict := range e.Conflicts {
+		paths[i] = conflict.Path
+	}
+	return paths
+}
+
+func (e *MergeConflictError) Error() string {
+	return "merge conflict in: " + strings.Join(e.Paths(), ", ")
+}
+
+func isGitErrorCode(err error, code git2go.ErrorCode) bool {
+	if gitErr, ok := err.(*git2go.GitError); ok {
+		return gitErr.Code == code
+	}
+	return false
+}
+
 func credentialsCallback(url string, username string, allowedTypes git2go.CredType) (git2go.ErrorCode, *git2go.Cred) {
 	return instance.getGitCredentials()
 }
 
 func certificateCheckCallback(cert *git2go.Certificate, valid bool, hostname string) git2go.ErrorCode {
-	// Made this one just return 0 during troubleshooting...
-	return 0
+	return instance.CheckCertificate(cert, valid, hostname)
 }
 
 func transferProgressCallback(stats git2go.TransferProgress) git2go.ErrorCode {
@@ -55,6 +110,43 @@ func pushTransferProgressCallback(current uint32, total uint32, bytes uint) git2
 	return instance.PrintPushTransferProgress(current, total, bytes)
 }
 
+//
+// CheckCertificate verifies ssh host keys against the known hosts, and
+// accepts any other certificate only if libgit2 found it valid.
+//
+func (git *Git) CheckCertificate(cert *git2go.Certificate, valid bool, hostname string) git2go.ErrorCode {
+	git.certErr = nil
+
+	if cert.Kind != git2go.CertificateHostkey {
+		if valid {
+			return git2go.ErrorCode(0)
+		}
+		git.certErr = errors.New("invalid certificate for host: " + hostname)
+		return git2go.ErrGeneric
+	}
+
+	kind, hash := "sha1", cert.Hostkey.HashSHA1[:]
+	if cert.Hostkey.Kind&git2go.HostkeySHA1 == 0 {
+		kind, hash = "md5", cert.Hostkey.HashMD5[:]
+	}
+
+	hostname = knownHostName(hostname, remotePort(git.remoteUrl))
+	if err := git.knownHosts.Check(hostname, kind, hash); err != nil {
+		debug("rejecting host key: %s", err)
+		git.certErr = err
+		return git2go.ErrGeneric
+	}
+	return git2go.ErrorCode(0)
+}
+
+// prefers the reason a certificate was rejected over libgit2's error
+func (git *Git) remoteError(err error) error {
+	if err != nil && git.certErr != nil {
+		return git.certErr
+	}
+	return err
+}
+
 //
 // HasRemote is true if the repository has a remote
 //
@@ -100,7 +192,8 @@ func (git *Git) PrintTransferCompletion(complete git2go.CompletionCallback) git2
 }
 
 //
-// Clone will clone a remote vault.
+// Clone will clone a remote vault.  Call `VerifyHistory` before the clone
+// is used.
 //
 func (git *Git) Clone(url string) error {
 	instance = git
@@ -119,9 +212,11 @@ func (git *Git) Clone(url string) error {
 		TransferProgressCallback: transferProgressCallback,
 	}
 
+	git.certErr = nil
+	git.remoteUrl = url
 	repo, err := git2go.Clone(url, git.path, &opts)
 	if err != nil {
-		return err
+		return git.remoteError(err)
 	}
 	git.repo = repo
 	return nil
@@ -130,30 +225,41 @@ func (git *Git) Clone(url string) error {
 //
 // NewGit creates a new git.  the `path` is the path of
 // the repository; the credentials contain the ssh credentials
-// used to commit and push remote repositories.
+// used to commit and push remote repositories.  Remote host keys
+// are checked against `knownHosts`.
 //
 // The same ssh key is used for encrypting/decrypting the keys.
 //
-func NewGit(path string, credentials *Credentials) *Git {
-	return &Git{path: path, credentials: credentials}
+func NewGit(path string, credentials *Credentials, knownHosts *KnownHosts) *Git {
+	return &Git{path: path, credentials: credentials, knownHosts: knownHosts}
 }
 
-//
-// Push will sync the repository to the remote, much like `git push`.
-// It does not handle merge conflicts currently.
-//
-func (git *Git) Push() error {
-
+func (git *Git) lookupOrigin() (*git2go.Remote, error) {
 	remote, err := git.repo.LookupRemote("origin")
 
 	if err != nil {
 		debug("no remote repository found:", err)
-		return err
+		return nil, err
 	}
 
 	if remote == nil {
 		debug("no remote repository found")
-		return errors.New("No remote found, did you call `SetRemote`?")
+		return nil, errors.New("No remote found, did you call `SetRemote`?")
+	}
+
+	return remote, nil
+}
+
+//
+// Push will send the local master to the remote, much like `git push`.
+// Call `Pull` first so the remote accepts it as a fast-forward.
+//
+func (git *Git) Push() error {
+
+	remote, err := git.lookupOrigin()
+
+	if err != nil {
+		return err
 	}
 
 	instance = git
@@ -172,9 +278,252 @@ func (git *Git) Push() error {
 
 	remote.SetCallbacks(cbs)
 
-	return remote.Push([]string{"refs/heads/master"}, nil)
+	git.certErr = nil
+	git.remoteUrl = remote.Url()
+	return git.remoteError(remote.Push([]string{"refs/heads/master"}, nil))
+}
+
+//
+// Fetch will download the remote objects and update refs/remotes/origin/*,
+// much like `git fetch origin`.
+//
+func (git *Git) Fetch() error {
+
+	remote, err := git.lookupOrigin()
+
+	if err != nil {
+		return err
+	}
+
+	instance = git
+	cbs := &git2go.RemoteCallbacks{
+		CredentialsCallback:      credentialsCallback,
+		CertificateCheckCallback: certificateCheckCallback,
+		TransferProgressCallback: transferProgressCallback,
+	}
+
+	defer func() {
+		if git.progressBar != nil {
+			git.progressBar.FinishPrint("Transfer complete!")
+		}
+		git.progressBar = nil
+	}()
+
+	remote.SetCallbacks(cbs)
+
+	git.certErr = nil
+	git.remoteUrl = remote.Url()
+	return git.remoteError(remote.Fetch(nil, ""))
+}
+
+//
+// Pull will fetch the remote, verify the signatures of the new commits and
+// merge origin/master into the local master, much like `git pull`.
+//
+func (git *Git) Pull() error {
+	if err := git.Fetch(); err != nil {
+		return err
+	}
 
-	// TODO: handle pull and sync etc
+	if err := git.verifyRemote(); err != nil {
+		return err
+	}
+	return git.Merge()
+}
+
+//
+// Merge will merge origin/master into the local master.
+//
+// Every secret is stored in its own file, so changes to different entries
+// merge cleanly.  If both sides changed the same file, a *MergeConflictError
+// is returned and the merge is left in progress (MERGE_HEAD is set): the
+// next `Merge` commits it once the conflicts are resolved, or `AbortMerge`
+// throws it away.
+//
+func (git *Git) Merge() error {
+
+	if git.repo == nil {
+		return errors.New("No repo - have you called Initialize()?")
+	}
+
+	merging, err := git.MergeInProgress()
+	if err != nil {
+		return err
+	}
+	if merging {
+		return git.resumeMerge()
+	}
+
+	remoteRef, err := git.repo.LookupReference("refs/remotes/origin/master")
+
+	if err != nil {
+		if isGitErrorCode(err, git2go.ErrNotFound) {
+			// the remote is empty, nothing to merge.
+			debug("no origin/master found")
+			return nil
+		}
+		return err
+	}
+
+	head, err := git.repo.Head()
+
+	if err != nil {
+		return err
+	}
+
+	localOid := head.Target()
+	remoteOid := remoteRef.Target()
+
+	if localOid.Equal(remoteOid) {
+		debug("already up to date")
+		return nil
+	}
+
+	base, err := git.repo.MergeBase(localOid, remoteOid)
+
+	if err != nil {
+		return err
+	}
+
+	if base.Equal(remoteOid) {
+		debug("local master is ahead of origin/master")
+		return nil
+	}
+
+	if base.Equal(localOid) {
+		debug("fast-forwarding to %s", remoteOid)
+		if _, err := head.SetTarget(remoteOid, "pull: fast-forward"); err != nil {
+			return err
+		}
+		return git.repo.CheckoutHead(&git2go.CheckoutOpts{Strategy: git2go.CheckoutForce})
+	}
+
+	theirs, err := git.repo.AnnotatedCommitFromRef(remoteRef)
+
+	if err != nil {
+		return err
+	}
+	defer theirs.Free()
+
+	// merges into the index and working tree, and sets MERGE_HEAD so that
+	// `CommitMerge` records origin/master as the second parent.
+	if err := git.repo.Merge([]*git2go.AnnotatedCommit{theirs}, nil, nil); err != nil {
+		return err
+	}
+
+	return git.resumeMerge()
+}
+
+// commits the merge in progress, or returns its conflicts if there are any
+// left in the index
+func (git *Git) resumeMerge() error {
+	idx, err := git.repo.Index()
+
+	if err != nil {
+		return err
+	}
+
+	if idx.HasConflicts() {
+		conflicts, err := git.readConflicts(idx)
+		if err != nil {
+			return err
+		}
+		return &MergeConflictError{Conflicts: conflicts}
+	}
+
+	return git.CommitMerge("Merge remote changes.")
+}
+
+//
+// MergeInProgress returns true if a merge has been started by `Merge` but
+// not committed or aborted yet.
+//
+func (git *Git) MergeInProgress() (bool, error) {
+	if git.repo == nil {
+		return false, nil
+	}
+
+	mergeHead, err := git.lookupMergeHead()
+	if err != nil {
+		return false, err
+	}
+	return mergeHead != nil, nil
+}
+
+//
+// AbortMerge will throw away a merge left behind by a *MergeConflictError,
+// much like `git merge --abort`.
+//
+func (git *Git) AbortMerge() error {
+	if err := git.repo.CheckoutHead(&git2go.CheckoutOpts{Strategy: git2go.CheckoutForce}); err != nil {
+		return err
+	}
+	return git.repo.StateCleanup()
+}
+
+//
+// DiscardChanges throws away every uncommitted change in the working tree,
+// much like `git checkout -f HEAD && git clean -f`.
+//
+func (git *Git) DiscardChanges() error {
+	return git.repo.CheckoutHead(&git2go.CheckoutOpts{
+		Strategy: git2go.CheckoutForce | git2go.CheckoutRemoveUntracked,
+	})
+}
+
+// reads one side of a conflict, which is empty if the side has no file
+func (git *Git) readConflictSide(entry *git2go.IndexEntry) (string, error) {
+	if entry == nil {
+		return "", nil
+	}
+	return git.readBlob(entry.Id)
+}
+
+func (git *Git) readConflicts(idx *git2go.Index) ([]*MergeConflict, error) {
+	conflicts := make([]*MergeConflict, 0)
+
+	iter, err := idx.ConflictIterator()
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Free()
+
+	for {
+		entries, err := iter.Next()
+		if err != nil {
+			if isGitErrorCode(err, git2go.ErrIterOver) {
+				break
+			}
+			return nil, err
+		}
+
+		conflict := &MergeConflict{}
+
+		switch {
+		case entries.Our != nil:
+			conflict.Path = entries.Our.Path
+		case entries.Their != nil:
+			conflict.Path = entries.Their.Path
+		default:
+			conflict.Path = entries.Ancestor.Path
+		}
+
+		if conflict.Ancestor, err = git.readConflictSide(entries.Ancestor); err != nil {
+			return nil, err
+		}
+
+		if conflict.Ours, err = git.readConflictSide(entries.Our); err != nil {
+			return nil, err
+		}
+
+		if conflict.Theirs, err = git.readConflictSide(entries.Their); err != nil {
+			return nil, err
+		}
+
+		conflicts = append(conflicts, conflict)
+	}
+
+	return conflicts, nil
 }
 
 //
@@ -226,6 +575,13 @@ func (git *Git) Initialize() error {
 }
 
 func (git *Git) getGitCredentials() (git2go.ErrorCode, *git2go.Cred) {
+	if sock := git.credentials.AgentSocket(); sock != "" {
+		// libgit2 finds the agent through SSH_AUTH_SOCK
+		os.Setenv("SSH_AUTH_SOCK", sock)
+		err, cred := git2go.NewCredSshKeyFromAgent("git")
+		return git2go.ErrorCode(err), &cred
+	}
+
 	err, cred := git2go.NewCredSshKey("git", git.credentials.PublicKeyPath,
 		git.credentials.PrivateKeyPath, git.credentials.Passphrase())
 	return git2go.ErrorCode(err), &cred
@@ -265,12 +621,55 @@ func (git *Git) findDeletedEntries() (paths []string, err error) {
 
 }
 
+// the commit being merged in, or nil if no merge is in progress
+func (g *Git) lookupMergeHead() (*git2go.Commit, error) {
+	ref, err := g.repo.LookupReference("MERGE_HEAD")
+
+	if err != nil {
+		if isGitErrorCode(err, git2go.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return g.repo.LookupCommit(ref.Target())
+}
+
 //
 // CommitAllChanges will commit all current changes in the
 // vault reopistory.  it is the equivalent of
 // "git add . ; git commit -a -m <msg>"
 //
+// ErrMergeInProgress is returned if a merge is unfinished, so that files
+// with conflicts are never committed by accident.
+//
 func (g *Git) CommitAllChanges(msg string) error {
+	merging, err := g.MergeInProgress()
+	if err != nil {
+		return err
+	}
+	if merging {
+		return ErrMergeInProgress
+	}
+	return g.commit(msg)
+}
+
+//
+// CommitMerge commits all current changes as the merge in progress, with
+// MERGE_HEAD as the second parent.  Call it once the conflicts are resolved.
+//
+func (g *Git) CommitMerge(msg string) error {
+	merging, err := g.MergeInProgress()
+	if err != nil {
+		return err
+	}
+	if !merging {
+		return errors.New("No merge in progress")
+	}
+	return g.commit(msg)
+}
+
+func (g *Git) commit(msg string) error {
 	var tip *git2go.Commit
 	var commit *git2go.Oid
 
@@ -321,15 +720,35 @@ func (g *Git) CommitAllChanges(msg string) error {
 		}
 	}
 
+	parents := make([]*git2go.Commit, 0, 2)
 	if tip != nil {
-		commit, err = g.repo.CreateCommit("HEAD", sig, sig, msg, tree, tip)
-	} else {
-		commit, err = g.repo.CreateCommit("HEAD", sig, sig, msg, tree)
+		parents = append(parents, tip)
 	}
 
+	mergeHead, err := g.lookupMergeHead()
 	if err != nil {
 		return err
 	}
+	if mergeHead != nil {
+		parents = append(parents, mergeHead)
+	}
+
+	signedMsg, err := g.signMessage(msg, oid, parents, sig)
+	if err != nil {
+		return err
+	}
+
+	commit, err = g.repo.CreateCommit("HEAD", sig, sig, signedMsg, tree, parents...)
+
+	if err != nil {
+		return err
+	}
+
+	if mergeHead != nil {
+		if err := g.repo.StateCleanup(); err != nil {
+			return err
+		}
+	}
 
 	// writes the index to disk
 	err = idx.Write()
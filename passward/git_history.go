@@ -0,0 +1,189 @@
+package passward
+
+import (
+	"errors"
+	"time"
+
+	git2go "github.com/libgit2/git2go"
+)
+
+//
+// Revision is a commit in the vault history.
+//
+type Revision struct {
+	Id   string
+	When time.Time
+}
+
+func (r *Revision) ShortId() string {
+	if len(r.Id) > 8 {
+		return r.Id[:8]
+	}
+	return r.Id
+}
+
+//
+// LookupRevision finds the commit named by `spec`, e.g. a full or
+// abbreviated commit id.
+//
+func (g *Git) LookupRevision(spec string) (*Revision, error) {
+	obj, err := g.repo.RevparseSingle(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	commit, err := g.repo.LookupCommit(obj.Id())
+	if err != nil {
+		return nil, err
+	}
+	return &Revision{Id: commit.Id().String(), When: commit.Committer().When}, nil
+}
+
+// calls `fn` with every commit reachable from `to`, or HEAD if it is nil,
+// but not from `hide`, in `sorting` order.  The walk stops when `fn`
+// returns false or an error.
+func (g *Git) walkCommits(sorting git2go.SortType, to *git2go.Oid, hide *git2go.Oid, fn func(*git2go.Commit) (bool, error)) error {
+	var fnErr error
+
+	if g.repo == nil {
+		return errors.New("No repo - have you called Initialize()?")
+	}
+
+	walk, err := g.repo.Walk()
+	if err != nil {
+		return err
+	}
+	defer walk.Free()
+
+	walk.Sorting(sorting)
+
+	if to == nil {
+		err = walk.PushHead()
+	} else {
+		err = walk.Push(to)
+	}
+	if err != nil {
+		return err
+	}
+
+	if hide != nil {
+		if err := walk.Hide(hide); err != nil {
+			return err
+		}
+	}
+
+	err = walk.Iterate(func(commit *git2go.Commit) bool {
+		var more bool
+		more, fnErr = fn(commit)
+		return more && fnErr == nil
+	})
+
+	if fnErr != nil {
+		return fnErr
+	}
+	return err
+}
+
+// reads the blob `id`
+func (g *Git) readBlob(id *git2go.Oid) (string, error) {
+	blob, err := g.repo.LookupBlob(id)
+	if err != nil {
+		return "", err
+	}
+	defer blob.Free()
+
+	return string(blob.Contents()), nil
+}
+
+// reads the file at `file` in `tree`
+func (g *Git) readTreeFile(tree *git2go.Tree, file string) (string, error) {
+	entry, err := tree.EntryByPath(file)
+	if err != nil {
+		return "", err
+	}
+	return g.readBlob(entry.Id)
+}
+
+//
+// RevisionAt finds the newest commit made at or before `when`.
+//
+func (g *Git) RevisionAt(when time.Time) (*Revision, error) {
+	var result *Revision
+
+	err := g.walkCommits(git2go.SortTime, nil, nil, func(commit *git2go.Commit) (bool, error) {
+		committed := commit.Committer().When
+		if committed.After(when) {
+			return true, nil
+		}
+		result = &Revision{Id: commit.Id().String(), When: committed}
+		return false, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if result == nil {
+		return nil, errors.New("No revision found at or before: " + when.String())
+	}
+	return result, nil
+}
+
+func (g *Git) revisionTree(rev *Revision) (*git2go.Tree, error) {
+	oid, err := git2go.NewOid(rev.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	commit, err := g.repo.LookupCommit(oid)
+	if err != nil {
+		return nil, err
+	}
+	return commit.Tree()
+}
+
+//
+// ReadFileAt returns the contents of `file` at revision `rev`.  A missing
+// file is reported with `IsNotFound`.
+//
+func (g *Git) ReadFileAt(rev *Revision, file string) (string, error) {
+	tree, err := g.revisionTree(rev)
+	if err != nil {
+		return "", err
+	}
+	return g.readTreeFile(tree, file)
+}
+
+//
+// ListDirAt returns the names in the directory `dir` at revision `rev`.
+//
+func (g *Git) ListDirAt(rev *Revision, dir string) ([]string, error) {
+	tree, err := g.revisionTree(rev)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := tree.EntryByPath(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	subtree, err := g.repo.LookupTree(entry.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	count := subtree.EntryCount()
+	names := make([]string, 0, count)
+	for i := uint64(0); i < count; i++ {
+		names = append(names, subtree.EntryByIndex(i).Name)
+	}
+	return names, nil
+}
+
+//
+// IsNotFound is true if `err` means a git object or path doesn't exist.
+//
+func IsNotFound(err error) bool {
+	return isGitErrorCode(err, git2go.ErrNotFound)
+}
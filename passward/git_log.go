@@ -0,0 +1,151 @@
+package passward
+
+import (
+	"strings"
+	"time"
+
+	git2go "github.com/libgit2/git2go"
+)
+
+//
+// FileChange is a file added, changed or removed by a commit.
+//
+type FileChange struct {
+	Path   string
+	Action string
+}
+
+//
+// Signature status of a commit, see `verifyCommit`.
+//
+const (
+	SignatureVerified = "verified"
+	SignatureUnsigned = "unsigned"
+	SignatureBad      = "bad"
+)
+
+//
+// LogEntry is a commit in the vault history.  The changes of a merge are
+// the ones it made to its first parent.
+//
+type LogEntry struct {
+	Commit    string
+	Author    string
+	Email     string
+	When      time.Time
+	Message   string
+	Signature string
+	Merge     bool
+	Changes   []*FileChange
+}
+
+//
+// Log walks the history from HEAD, newest first, and returns every commit
+// made at or after `since` with the files it changed.
+//
+func (g *Git) Log(since time.Time) ([]*LogEntry, error) {
+	entries := make([]*LogEntry, 0)
+
+	err := g.walkCommits(git2go.SortTime, nil, nil, func(commit *git2go.Commit) (bool, error) {
+		if commit.Author().When.Before(since) {
+			return true, nil
+		}
+
+		entry, err := g.logEntry(commit)
+		if err != nil {
+			return false, err
+		}
+
+		entries = append(entries, entry)
+		return true, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (g *Git) logEntry(commit *git2go.Commit) (*LogEntry, error) {
+	var parentTree *git2go.Tree
+
+	author := commit.Author()
+	msg, _ := SplitSignedMessage(commit.Message())
+
+	status, err := g.signatureStatus(commit)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &LogEntry{
+		Commit:    commit.Id().String(),
+		Author:    author.Name,
+		Email:     author.Email,
+		When:      author.When,
+		Message:   strings.TrimSpace(msg),
+		Signature: status,
+		Merge:     commit.ParentCount() > 1,
+		Changes:   make([]*FileChange, 0),
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	// a merge is compared with the local side, so it lists what the merge
+	// brought in, including the resolution of any conflicts.
+	if commit.ParentCount() > 0 {
+		if parentTree, err = commit.Parent(0).Tree(); err != nil {
+			return nil, err
+		}
+	}
+
+	diff, err := g.repo.DiffTreeToTree(parentTree, tree, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer diff.Free()
+
+	count, err := diff.NumDeltas()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < count; i++ {
+		delta, err := diff.GetDelta(i)
+		if err != nil {
+			return nil, err
+		}
+
+		change := &FileChange{Path: delta.NewFile.Path, Action: "changed"}
+		switch delta.Status {
+		case git2go.DeltaAdded:
+			change.Action = "added"
+		case git2go.DeltaDeleted:
+			change.Action = "removed"
+			change.Path = delta.OldFile.Path
+		}
+		entry.Changes = append(entry.Changes, change)
+	}
+
+	return entry, nil
+}
+
+// verifies the signature of `commit`, see the Signature* constants
+func (g *Git) signatureStatus(commit *git2go.Commit) (string, error) {
+	if _, signature := SplitSignedMessage(commit.Message()); signature == "" {
+		return SignatureUnsigned, nil
+	}
+
+	err := g.verifyCommit(commit)
+	if err == nil {
+		return SignatureVerified, nil
+	}
+
+	if _, ok := err.(*SignatureError); ok {
+		debug("commit %s failed verification: %s", commit.Id(), err)
+		return SignatureBad, nil
+	}
+	return "", err
+}
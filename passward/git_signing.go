@@ -0,0 +1,197 @@
+package passward
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	git2go "github.com/libgit2/git2go"
+)
+
+//
+// Vault commits are signed with the committer's ssh key.  The signature
+// covers the tree, parents, author and message, and is appended to the
+// commit message as a trailer:
+//
+//   <message>
+//
+//   Passward-Signature: <base64 ssh signature>
+//
+const signatureTrailer = "\n\nPassward-Signature: "
+
+//
+// SignatureError is returned when a commit from the remote isn't signed by
+// a key in users/<email>/key.
+//
+type SignatureError struct {
+	Commit string
+	Email  string
+	Reason string
+}
+
+func (e *SignatureError) Error() string {
+	return "commit " + e.Commit + " by " + e.Email + " failed verification: " + e.Reason
+}
+
+// the bytes covered by a commit signature
+func commitPayload(tree *git2go.Oid, parents []*git2go.Oid, author *git2go.Signature, msg string) []byte {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "tree %s\n", tree)
+	for _, parent := range parents {
+		fmt.Fprintf(&buf, "parent %s\n", parent)
+	}
+	fmt.Fprintf(&buf, "author %s <%s> %d\n\n", author.Name, author.Email, author.When.Unix())
+	buf.WriteString(msg)
+
+	return buf.Bytes()
+}
+
+//
+// SplitSignedMessage splits a commit message into the message and its
+// signature, which is empty if the commit isn't signed.
+//
+func SplitSignedMessage(msg string) (string, string) {
+	idx := strings.LastIndex(msg, signatureTrailer)
+	if idx < 0 {
+		return msg, ""
+	}
+	return msg[:idx], strings.TrimSpace(msg[idx+len(signatureTrailer):])
+}
+
+func (g *Git) signMessage(msg string, tree *git2go.Oid, parents []*git2go.Commit, author *git2go.Signature) (string, error) {
+	if !g.credentials.IsUnlocked() {
+		return "", errors.New("Credentials must be unlocked to sign commits.")
+	}
+
+	ids := make([]*git2go.Oid, len(parents))
+	for i, parent := range parents {
+		ids[i] = parent.Id()
+	}
+
+	signature, err := g.credentials.GetKeys().Sign(commitPayload(tree, ids, author, msg))
+	if err != nil {
+		return "", err
+	}
+	return msg + signatureTrailer + signature + "\n", nil
+}
+
+func (g *Git) verifyCommit(commit *git2go.Commit) error {
+	var keys *git2go.Tree
+	var err error
+
+	author := commit.Author()
+	id := commit.Id().String()
+
+	msg, signature := SplitSignedMessage(commit.Message())
+	if signature == "" {
+		return &SignatureError{Commit: id, Email: author.Email, Reason: "commit is not signed"}
+	}
+
+	// keys are trusted as of the first parent, so only an existing user
+	// can add a new one.  The first commit of a vault is trusted on clone.
+	if commit.ParentCount() > 0 {
+		keys, err = commit.Parent(0).Tree()
+	} else {
+		keys, err = commit.Tree()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	publicKey, err := g.readTreeFile(keys, path.Join("users", author.Email, "key"))
+	if err != nil {
+		debug("no key found for %s: %s", author.Email, err)
+		return &SignatureError{Commit: id, Email: author.Email, Reason: "unknown user"}
+	}
+
+	parents := make([]*git2go.Oid, commit.ParentCount())
+	for i := range parents {
+		parents[i] = commit.ParentId(uint(i))
+	}
+
+	payload := commitPayload(commit.TreeId(), parents, author, msg)
+	if err := VerifySshSignature(publicKey, payload, signature); err != nil {
+		return &SignatureError{Commit: id, Email: author.Email, Reason: "bad signature: " + err.Error()}
+	}
+	return nil
+}
+
+//
+// VerifyCommits checks the signature of every commit reachable from `to`
+// but not from `from`, oldest first.  If `from` is nil, the whole history
+// is checked.
+//
+func (g *Git) VerifyCommits(from *git2go.Oid, to *git2go.Oid) error {
+	return g.walkCommits(git2go.SortTopological|git2go.SortReverse, to, from, func(commit *git2go.Commit) (bool, error) {
+		return true, g.verifyCommit(commit)
+	})
+}
+
+//
+// VerifyHistory checks the signature of every commit after `signedAfter`,
+// the last commit made before the vault was signed, or of the whole
+// history if it is empty.
+//
+func (g *Git) VerifyHistory(signedAfter string) error {
+	var from *git2go.Oid
+
+	head, err := g.repo.Head()
+	if err != nil {
+		return err
+	}
+
+	if signedAfter != "" {
+		if from, err = git2go.NewOid(signedAfter); err != nil {
+			return err
+		}
+	}
+	return g.VerifyCommits(from, head.Target())
+}
+
+//
+// UnsignedHistory returns true if any commit reachable from HEAD isn't
+// signed, e.g. because it was made before vault commits were signed.
+//
+func (g *Git) UnsignedHistory() (bool, error) {
+	unsigned := false
+
+	err := g.walkCommits(git2go.SortNone, nil, nil, func(commit *git2go.Commit) (bool, error) {
+		_, signature := SplitSignedMessage(commit.Message())
+		unsigned = signature == ""
+		return !unsigned, nil
+	})
+	return unsigned, err
+}
+
+// the id of the commit HEAD points to
+func (g *Git) headId() (string, error) {
+	head, err := g.repo.Head()
+	if err != nil {
+		return "", err
+	}
+	return head.Target().String(), nil
+}
+
+// verifies the commits fetched into origin/master that we don't have yet
+func (g *Git) verifyRemote() error {
+	remoteRef, err := g.repo.LookupReference("refs/remotes/origin/master")
+
+	if err != nil {
+		if isGitErrorCode(err, git2go.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	head, err := g.repo.Head()
+
+	if err != nil {
+		return err
+	}
+
+	return g.VerifyCommits(head.Target(), remoteRef.Target())
+}
@@ -0,0 +1,166 @@
+package passward
+
+import (
+	"crypto/rand"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	git2go "github.com/libgit2/git2go"
+	"golang.org/x/crypto/ed25519"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// writes an ed25519 keypair, encrypted with `passphrase` unless it is
+// empty, to `dir`, and returns credentials unlocked with it
+func testCredentials(t *testing.T, dir string, email string, passphrase string) *Credentials {
+	var block *pem.Block
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if passphrase == "" {
+		block, err = gossh.MarshalPrivateKey(privateKey, email)
+	} else {
+		block, err = gossh.MarshalPrivateKeyWithPassphrase(privateKey, email, []byte(passphrase))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sshPublicKey, err := gossh.NewPublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	creds := &Credentials{
+		Name:           email,
+		Email:          email,
+		PublicKeyPath:  filepath.Join(dir, "id_ed25519.pub"),
+		PrivateKeyPath: filepath.Join(dir, "id_ed25519"),
+	}
+
+	if err := ioutil.WriteFile(creds.PrivateKeyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(creds.PublicKeyPath, gossh.MarshalAuthorizedKey(sshPublicKey), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := creds.Unlock(passphrase); err != nil {
+		t.Fatal(err)
+	}
+	return creds
+}
+
+func writeTestFile(t *testing.T, file string, contents string) {
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// commits the working tree without a signature, as vaults did before their
+// commits were signed
+func commitUnsigned(t *testing.T, g *Git, msg string) *git2go.Oid {
+	idx, err := g.repo.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := idx.AddAll([]string{"**"}, git2go.IndexAddDefault, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	treeId, err := idx.WriteTree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := g.repo.LookupTree(treeId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parents := make([]*git2go.Commit, 0, 1)
+	if head, err := g.repo.Head(); err == nil {
+		tip, err := g.repo.LookupCommit(head.Target())
+		if err != nil {
+			t.Fatal(err)
+		}
+		parents = append(parents, tip)
+	}
+
+	sig := &git2go.Signature{Name: "legacy", Email: "legacy@example.com", When: time.Now()}
+	oid, err := g.repo.CreateCommit("HEAD", sig, sig, msg, tree, parents...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return oid
+}
+
+func TestCloneLegacyHistory(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "passward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	email := "me@example.com"
+	creds := testCredentials(t, dir, email, "")
+	originPath := filepath.Join(dir, "origin")
+
+	origin := NewGit(originPath, creds, nil)
+	if err := origin.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestFile(t, filepath.Join(originPath, "users", email, "key"), creds.PublicKeyString())
+	legacy := commitUnsigned(t, origin, "Legacy commit.")
+
+	writeTestFile(t, filepath.Join(originPath, "keys", "site", "passphrase"), "secret")
+	if err := origin.CommitAllChanges("Signed commit."); err != nil {
+		t.Fatal(err)
+	}
+
+	clone := NewGit(filepath.Join(dir, "clone"), creds, nil)
+	if err := clone.Clone(originPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := clone.VerifyHistory(""); err == nil {
+		t.Fatal("expected the unsigned legacy commit to fail verification")
+	} else if _, ok := err.(*SignatureError); !ok {
+		t.Fatal("expected *SignatureError, got:", err)
+	}
+
+	if err := clone.VerifyHistory(legacy.String()); err != nil {
+		t.Fatal("expected the history after the legacy commit to verify:", err)
+	}
+
+	// commits after the cutoff must still be signed
+	writeTestFile(t, filepath.Join(originPath, "keys", "site", "passphrase"), "forged")
+	commitUnsigned(t, origin, "Forged commit.")
+
+	forged := NewGit(filepath.Join(dir, "forged"), creds, nil)
+	if err := forged.Clone(originPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := forged.VerifyHistory(legacy.String()); err == nil {
+		t.Fatal("expected the unsigned commit after the cutoff to fail verification")
+	} else if _, ok := err.(*SignatureError); !ok {
+		t.Fatal("expected *SignatureError, got:", err)
+	}
+}
@@ -0,0 +1,88 @@
+package passward
+
+import (
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jandre/passward/util"
+	"golang.org/x/crypto/ed25519"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+const generatedKeyName = "passward_ed25519"
+
+//
+// GenerateSshKeyRing creates a new Ed25519 keypair in `directory`, with the
+// private key encrypted by `passphrase`.  The keys are written in the same
+// OpenSSH format ssh-keygen uses, bcrypt KDF included, so they can also be
+// used for git remotes.  Keys left by an earlier run are reused if
+// `passphrase` unlocks them, so a setup that failed can be run again.
+//
+func GenerateSshKeyRing(directory string, comment string, passphrase string) (*SshKeyRing, error) {
+	if passphrase == "" {
+		return nil, errors.New("A passphrase is required to protect the private key")
+	}
+
+	directory, err := filepath.Abs(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKeyPath := filepath.Join(directory, generatedKeyName)
+	publicKeyPath := privateKeyPath + ".pub"
+
+	if util.FileExists(privateKeyPath) || util.FileExists(publicKeyPath) {
+		keys, err := NewSshKeyRing(publicKeyPath, privateKeyPath, passphrase)
+		if err != nil {
+			return nil, errors.New("Keys already exist at: " + privateKeyPath + ", and can't be unlocked with this passphrase: " + err.Error())
+		}
+		return keys, nil
+	}
+
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return nil, err
+	}
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := gossh.MarshalPrivateKeyWithPassphrase(private, comment, []byte(passphrase))
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, err := gossh.NewPublicKey(public)
+	if err != nil {
+		return nil, err
+	}
+
+	authorizedKey := strings.TrimSpace(string(gossh.MarshalAuthorizedKey(publicKey)))
+	if comment != "" {
+		authorizedKey += " " + comment
+	}
+
+	if err := ioutil.WriteFile(privateKeyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		return nil, err
+	}
+
+	if err := ioutil.WriteFile(publicKeyPath, []byte(authorizedKey+"\n"), 0644); err != nil {
+		os.Remove(privateKeyPath)
+		return nil, err
+	}
+
+	return NewSshKeyRing(publicKeyPath, privateKeyPath, passphrase)
+}
+
+//
+// KeysPath is where passward keeps the keypairs it generates.
+//
+func KeysPath(directory string) string {
+	return filepath.Join(directory, "keys")
+}
@@ -0,0 +1,65 @@
+package passward
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestGenerateSshKeyRing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "passward-keygen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keysPath := KeysPath(dir)
+	keys, err := GenerateSshKeyRing(keysPath, "test@example.com", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(keys.PrivateKeyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Error("private key should only be readable by the owner, got", info.Mode())
+	}
+
+	if _, err := NewSshKeyRing(keys.PublicKeyPath, keys.PrivateKeyPath, "wrong"); err == nil {
+		t.Error("private key should not parse with the wrong passphrase")
+	}
+
+	reopened, err := NewSshKeyRing(filepath.Join(keysPath, "passward_ed25519.pub"), keys.PrivateKeyPath, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reopened.Supported() {
+		t.Error("generated key should be supported for encryption")
+	}
+
+	pemBytes, err := ioutil.ReadFile(keys.PrivateKeyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gossh.ParseRawPrivateKey(pemBytes); err == nil {
+		t.Error("private key should be encrypted")
+	}
+
+	// a setup that is run again reuses the keys
+	again, err := GenerateSshKeyRing(keysPath, "test@example.com", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.PublicKeyString() != keys.PublicKeyString() {
+		t.Error("expected the existing keys to be reused")
+	}
+
+	if _, err := GenerateSshKeyRing(keysPath, "", "other"); err == nil {
+		t.Error("should refuse to overwrite keys it can't unlock")
+	}
+}
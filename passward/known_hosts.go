@@ -0,0 +1,257 @@
+package passward
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/jandre/passward/util"
+)
+
+//
+// HostKeyError is returned when a remote presents a host key that doesn't
+// match the one we know for it.
+//
+type HostKeyError struct {
+	Host        string
+	Fingerprint string
+	Reason      string
+}
+
+func (e *HostKeyError) Error() string {
+	return "host key verification failed for " + e.Host + " (" + e.Fingerprint + "): " + e.Reason
+}
+
+//
+// KnownHosts checks ssh host keys against ~/.ssh/known_hosts, and falls
+// back to a passward-managed known_hosts file that trusts a host the first
+// time it is seen.
+//
+// libgit2 only gives us a hash of the host key, so the passward file
+// stores "<host> <sha1|md5> <hex hash>" lines.
+//
+type KnownHosts struct {
+	path    string
+	sshPath string
+}
+
+func NewKnownHosts(path string, sshPath string) *KnownHosts {
+	return &KnownHosts{path: path, sshPath: sshPath}
+}
+
+// known hosts for the vaults in `vaultPath`, i.e. ~/.passward/vaults
+func newKnownHosts(vaultPath string) *KnownHosts {
+	return NewKnownHosts(path.Join(path.Dir(vaultPath), "known_hosts"),
+		path.Join(GetSshKeyRingPath(), "known_hosts"))
+}
+
+func hashHostKey(kind string, blob []byte) []byte {
+	if kind == "md5" {
+		sum := md5.Sum(blob)
+		return sum[:]
+	}
+	sum := sha1.Sum(blob)
+	return sum[:]
+}
+
+// true if `hostname` matches a hashed (|1|salt|hash) known_hosts pattern
+func matchHashedHost(pattern string, hostname string) bool {
+	parts := strings.Split(strings.TrimPrefix(pattern, "|1|"), "|")
+	if len(parts) != 2 {
+		return false
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(parts[0])
+	if err != nil {
+		return false
+	}
+
+	expected, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(hostname))
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// `[` and `]` are literal in known_hosts patterns, where only `*` and `?`
+// are wildcards
+var hostPatternEscaper = strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`)
+
+func matchHostPattern(pattern string, hostname string) bool {
+	if strings.HasPrefix(pattern, "|1|") {
+		return matchHashedHost(pattern, hostname)
+	}
+	matched, _ := path.Match(hostPatternEscaper.Replace(pattern), hostname)
+	return matched
+}
+
+// true if `hostname` matches the comma separated `patterns` of a
+// known_hosts line.  A matching !pattern rules the line out, whatever else
+// matches.
+func matchHost(patterns string, hostname string) bool {
+	matched := false
+	for _, pattern := range strings.Split(patterns, ",") {
+		negated := strings.HasPrefix(pattern, "!")
+		if !matchHostPattern(strings.TrimPrefix(pattern, "!"), hostname) {
+			continue
+		}
+		if negated {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+// the port of an ssh://host:port/ url, or "" for the default port and for
+// scp-like user@host:path urls
+func remotePort(remote string) string {
+	if !strings.Contains(remote, "://") {
+		return ""
+	}
+	u, err := url.Parse(remote)
+	if err != nil {
+		return ""
+	}
+	return u.Port()
+}
+
+// the name `hostname` is known by in known_hosts files: [host]:port when
+// the ssh port isn't 22
+func knownHostName(hostname string, port string) string {
+	if port == "" || port == "22" {
+		return hostname
+	}
+	return "[" + hostname + "]:" + port
+}
+
+// reads the key blobs for `hostname` from an openssh known_hosts file
+func readSshKnownHosts(file string, hostname string) ([][]byte, error) {
+	blobs := make([][]byte, 0)
+
+	if !util.FileExists(file) {
+		return blobs, nil
+	}
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+
+		// skip comments, and @cert-authority or @revoked lines
+		if len(fields) < 3 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "@") {
+			continue
+		}
+
+		if !matchHost(fields[0], hostname) {
+			continue
+		}
+
+		blob, err := base64.StdEncoding.DecodeString(fields[2])
+		if err != nil {
+			debug("skipping bad known_hosts key for %s: %s", hostname, err)
+			continue
+		}
+		blobs = append(blobs, blob)
+	}
+
+	return blobs, scanner.Err()
+}
+
+// returns the hash recorded for `hostname` in the passward file, or ""
+func (kh *KnownHosts) lookup(hostname string, kind string) (string, error) {
+	if !util.FileExists(kh.path) {
+		return "", nil
+	}
+
+	content, err := ioutil.ReadFile(kh.path)
+	if err != nil {
+		return "", err
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 3 && fields[0] == hostname && fields[1] == kind {
+			return fields[2], nil
+		}
+	}
+	return "", nil
+}
+
+func (kh *KnownHosts) add(hostname string, kind string, fingerprint string) error {
+	file, err := os.OpenFile(kh.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = fmt.Fprintf(file, "%s %s %s\n", hostname, kind, fingerprint)
+	return err
+}
+
+//
+// Check verifies that `hash`, the `kind` (sha1 or md5) hash of the host key
+// presented by `hostname`, is known.  Unknown hosts are trusted and recorded.
+// A host on a port other than 22 is named [host]:port, like openssh does.
+//
+func (kh *KnownHosts) Check(hostname string, kind string, hash []byte) error {
+	fingerprint := hex.EncodeToString(hash)
+
+	blobs, err := readSshKnownHosts(kh.sshPath, hostname)
+	if err != nil {
+		return err
+	}
+
+	if len(blobs) > 0 {
+		for _, blob := range blobs {
+			if hmac.Equal(hashHostKey(kind, blob), hash) {
+				return nil
+			}
+		}
+		return &HostKeyError{
+			Host:        hostname,
+			Fingerprint: kind + ":" + fingerprint,
+			Reason:      "the host key does not match " + kh.sshPath + "; it may have changed, or someone may be intercepting the connection",
+		}
+	}
+
+	recorded, err := kh.lookup(hostname, kind)
+	if err != nil {
+		return err
+	}
+
+	if recorded != "" {
+		if recorded == fingerprint {
+			return nil
+		}
+		return &HostKeyError{
+			Host:        hostname,
+			Fingerprint: kind + ":" + fingerprint,
+			Reason:      "the host key has changed since it was first trusted in " + kh.path + "; it may have been replaced, or someone may be intercepting the connection",
+		}
+	}
+
+	if err := kh.add(hostname, kind, fingerprint); err != nil {
+		return err
+	}
+	log.Printf("Permanently added %s (%s:%s) to %s.\n", hostname, kind, fingerprint, kh.path)
+	return nil
+}
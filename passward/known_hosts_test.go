@@ -0,0 +1,115 @@
+package passward
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestKnownHostsSshFile(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "passward")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	blob := []byte("host key blob")
+	salt := []byte("salt")
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte("git.example.com"))
+	hashed := "|1|" + base64.StdEncoding.EncodeToString(salt) + "|" + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	sshPath := path.Join(dir, "ssh_known_hosts")
+	line := hashed + " ssh-rsa " + base64.StdEncoding.EncodeToString(blob) + "\n"
+	if err := ioutil.WriteFile(sshPath, []byte(line), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	kh := NewKnownHosts(path.Join(dir, "known_hosts"), sshPath)
+
+	if err := kh.Check("git.example.com", "sha1", hashHostKey("sha1", blob)); err != nil {
+		t.Fatal(err)
+	}
+
+	err = kh.Check("git.example.com", "sha1", hashHostKey("sha1", []byte("other key")))
+	if _, ok := err.(*HostKeyError); !ok {
+		t.Fatal("expected *HostKeyError, got:", err)
+	}
+}
+
+func TestKnownHostsTrustOnFirstUse(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "passward")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	kh := NewKnownHosts(path.Join(dir, "known_hosts"), path.Join(dir, "missing"))
+
+	for i := 0; i < 2; i++ {
+		if err := kh.Check("git.example.com", "sha1", hashHostKey("sha1", []byte("key"))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = kh.Check("git.example.com", "sha1", hashHostKey("sha1", []byte("changed key")))
+	if _, ok := err.(*HostKeyError); !ok {
+		t.Fatal("expected *HostKeyError, got:", err)
+	}
+}
+
+func TestMatchHost(t *testing.T) {
+
+	salt := []byte("salt")
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte("[git.example.com]:2222"))
+	hashed := "|1|" + base64.StdEncoding.EncodeToString(salt) + "|" + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	for _, test := range []struct {
+		patterns string
+		hostname string
+		expected bool
+	}{
+		{"git.example.com", "git.example.com", true},
+		{"git.example.com", "[git.example.com]:2222", false},
+		{"[git.example.com]:2222", "[git.example.com]:2222", true},
+		{"[git.example.com]:2222", "git.example.com", false},
+		{"[*.example.com]:2222", "[git.example.com]:2222", true},
+		{hashed, "[git.example.com]:2222", true},
+		{hashed, "git.example.com", false},
+		{"*.example.com", "git.example.com", true},
+		{"*.example.com,!git.example.com", "git.example.com", false},
+		{"!git.example.com,*.example.com", "git.example.com", false},
+		{"*.example.com,!git.example.com", "www.example.com", true},
+		{"!git.example.com", "www.example.com", false},
+	} {
+		if matchHost(test.patterns, test.hostname) != test.expected {
+			t.Error("expected", test.patterns, "matching", test.hostname, "to be", test.expected)
+		}
+	}
+}
+
+func TestKnownHostName(t *testing.T) {
+
+	for _, test := range []struct {
+		url      string
+		expected string
+	}{
+		{"git@git.example.com:me/vault.git", "git.example.com"},
+		{"ssh://git@git.example.com/me/vault.git", "git.example.com"},
+		{"ssh://git@git.example.com:22/me/vault.git", "git.example.com"},
+		{"ssh://git@git.example.com:2222/me/vault.git", "[git.example.com]:2222"},
+	} {
+		if name := knownHostName("git.example.com", remotePort(test.url)); name != test.expected {
+			t.Error("expected", test.expected, "for", test.url, "got:", name)
+		}
+	}
+}
@@ -81,7 +81,7 @@ func (pw *Passward) FetchVault(url string, name string) (*Vault, error) {
 
 	creds := pw.GetCredentials()
 	// make a tmpdir
-	git := NewGit(tmpDir, creds)
+	git := NewGit(tmpDir, creds, newKnownHosts(pw.vaultPath()))
 
 	debug("cloning to ", tmpDir)
 
@@ -93,7 +93,13 @@ func (pw *Passward) FetchVault(url string, name string) (*Vault, error) {
 
 	vault, err := ReadVault(pw.vaultPath(), name, pw.GetCredentials())
 
+	if err == nil {
+		err = vault.verifyHistory()
+	}
+
 	if err != nil {
+		debug("removing unverified clone: %s", err)
+		os.RemoveAll(tmpDir)
 		return nil, err
 	}
 
@@ -107,9 +113,10 @@ func (pw *Passward) FetchVault(url string, name string) (*Vault, error) {
 }
 
 //
-// Add a vault to the ~/.passward/vaults
+// Add a vault to the ~/.passward/vaults.  If `encryptNames` is set, the
+// entry names are encrypted in the vault.
 //
-func (pw *Passward) AddVault(name string) error {
+func (pw *Passward) AddVault(name string, encryptNames bool) error {
 	// check to see if there is a vault with the name already
 	if pw.vaults[name] != nil {
 		return errors.New("Vault " + name + " already exists!")
@@ -117,7 +124,7 @@ func (pw *Passward) AddVault(name string) error {
 
 	creds := pw.GetCredentials()
 
-	if vault, err := NewVault(pw.vaultPath(), name, creds); err != nil {
+	if vault, err := NewVault(pw.vaultPath(), name, creds, encryptNames); err != nil {
 		return err
 	} else {
 
@@ -164,6 +171,15 @@ func DetectPasswardPath() string {
 	return filepath.Join(home, ".passward")
 }
 
+//
+// PasswardExists returns true if a passward config has been saved in
+// `directory`. The directory itself may exist without one, e.g. when setup
+// has generated keys under it.
+//
+func PasswardExists(directory string) bool {
+	return util.FileExists(filepath.Join(directory, "config.toml"))
+}
+
 func NewPassward(directory string) (*Passward, error) {
 	var conf Passward
 	if directory == "" {
@@ -176,7 +192,7 @@ func NewPassward(directory string) (*Passward, error) {
 		return nil, err
 	}
 
-	if util.DirectoryExists(directory) {
+	if PasswardExists(directory) {
 		return nil, errors.New("passward home already exists:" + directory)
 	}
 
@@ -0,0 +1,156 @@
+package passward
+
+import (
+	"errors"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//
+// SearchOptions controls `Passward.Search`.  `Pattern` is a glob, or a
+// regular expression if `Regex` is set; a glob without wildcards matches
+// anywhere in the name.  Matching ignores case.
+//
+type SearchOptions struct {
+	Pattern string
+	Regex   bool
+
+	// only search this vault, if set
+	Vault string
+
+	// also match the decrypted username and description of each entry
+	Fields bool
+}
+
+//
+// SearchResult is an entry that matched, and which of its parts did:
+// "name", "username" or "description".
+//
+type SearchResult struct {
+	Vault   string
+	Entry   string
+	Matched []string
+}
+
+// fields that are decrypted and searched with `SearchOptions.Fields`
+var searchFields = []string{"username", "description"}
+
+func (opts *SearchOptions) matcher() (func(string) bool, error) {
+	if opts.Regex {
+		re, err := regexp.Compile("(?i)" + opts.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+	}
+
+	pattern := strings.ToLower(opts.Pattern)
+	if !strings.ContainsAny(pattern, "*?[") {
+		pattern = "*" + pattern + "*"
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, errors.New("Invalid pattern: " + opts.Pattern)
+	}
+
+	return func(s string) bool {
+		matched, _ := path.Match(pattern, strings.ToLower(s))
+		return matched
+	}, nil
+}
+
+//
+// NeedsUnlock returns true if the search has to decrypt anything, either
+// fields or the names of an encrypted-names vault.
+//
+func (pw *Passward) NeedsUnlock(opts SearchOptions) bool {
+	if opts.Fields {
+		return true
+	}
+	for _, vault := range pw.SearchedVaults(opts) {
+		if vault.EncryptedNames {
+			return true
+		}
+	}
+	return false
+}
+
+//
+// SearchedVaults returns the vaults `Search` looks through.
+//
+func (pw *Passward) SearchedVaults(opts SearchOptions) []*Vault {
+	vaults := make([]*Vault, 0, len(pw.vaults))
+	for name, vault := range pw.vaults {
+		if opts.Vault == "" || opts.Vault == name {
+			vaults = append(vaults, vault)
+		}
+	}
+	return vaults
+}
+
+type bySearchOrder []SearchResult
+
+func (r bySearchOrder) Len() int      { return len(r) }
+func (r bySearchOrder) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r bySearchOrder) Less(i, j int) bool {
+	if r[i].Vault != r[j].Vault {
+		return r[i].Vault < r[j].Vault
+	}
+	return r[i].Entry < r[j].Entry
+}
+
+//
+// Search returns the entries of every vault that match `opts`, sorted by
+// vault and entry name.
+//
+func (pw *Passward) Search(opts SearchOptions) ([]SearchResult, error) {
+	match, err := opts.matcher()
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Vault != "" && pw.vaults[opts.Vault] == nil {
+		return nil, errors.New("Vault not found: " + opts.Vault)
+	}
+
+	results := make([]SearchResult, 0)
+
+	for _, vault := range pw.SearchedVaults(opts) {
+		var key []byte
+		if opts.Fields || vault.EncryptedNames {
+			if key, err = vault.unlockMasterKey(); err != nil {
+				return nil, err
+			}
+		}
+
+		for name, entry := range vault.Entries() {
+			matched := make([]string, 0)
+			if match(name) {
+				matched = append(matched, "name")
+			}
+
+			if opts.Fields {
+				for _, field := range searchFields {
+					if _, ok := entry.encryptedValues[field]; !ok {
+						continue
+					}
+					val, err := entry.Reveal(field, key)
+					if err != nil {
+						return nil, err
+					}
+					if match(val) {
+						matched = append(matched, field)
+					}
+				}
+			}
+
+			if len(matched) > 0 {
+				results = append(results, SearchResult{Vault: vault.Name, Entry: name, Matched: matched})
+			}
+		}
+	}
+
+	sort.Sort(bySearchOrder(results))
+	return results, nil
+}
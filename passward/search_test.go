@@ -0,0 +1,35 @@
+package passward
+
+import (
+	"testing"
+)
+
+func TestSearchMatcher(t *testing.T) {
+
+	cases := []struct {
+		opts    SearchOptions
+		name    string
+		matched bool
+	}{
+		{SearchOptions{Pattern: "bank"}, "com.MyBank", true},
+		{SearchOptions{Pattern: "com.*"}, "com.bank", true},
+		{SearchOptions{Pattern: "com.*"}, "org.com.bank", false},
+		{SearchOptions{Pattern: "^(com|org)\\.", Regex: true}, "org.bank", true},
+		{SearchOptions{Pattern: "bank$", Regex: true}, "bank.com", false},
+	}
+
+	for _, c := range cases {
+		match, err := c.opts.matcher()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if match(c.name) != c.matched {
+			t.Fatal("unexpected match for", c.opts.Pattern, c.name)
+		}
+	}
+
+	opts := SearchOptions{Pattern: "[", Regex: false}
+	if _, err := opts.matcher(); err == nil {
+		t.Fatal("expected an invalid glob to fail")
+	}
+}
@@ -0,0 +1,265 @@
+package passward
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+
+	"github.com/jandre/passward/util"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+//
+// Unlocking through ssh-agent: each enrolled user keeps a random challenge
+// in users/<email>/agent_challenge, and the vault master key encrypted with
+// the agent's signature over that challenge in users/<email>/agent_master.
+// RSA and Ed25519 signatures are deterministic, so the agent can always
+// recreate the key without the private key ever leaving it.
+//
+
+const agentChallengeSize = 32
+
+//
+// sshAgentSigner returns the signer of the running ssh-agent
+// (SSH_AUTH_SOCK) that holds the private half of `publicKey`.
+//
+func sshAgentSigner(publicKey string) (gossh.Signer, error) {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, errors.New("No ssh-agent found: SSH_AUTH_SOCK is not set")
+	}
+
+	key, _, _, _, err := gossh.ParseAuthorizedKey([]byte(publicKey))
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, err
+	}
+
+	// the connection stays open for as long as the signer is used.
+	signers, err := agent.NewClient(conn).Signers()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	for _, signer := range signers {
+		if bytes.Equal(signer.PublicKey().Marshal(), key.Marshal()) {
+			return signer, nil
+		}
+	}
+
+	conn.Close()
+	return nil, errors.New("Your key is not loaded in ssh-agent; add it with `ssh-add`")
+}
+
+// the passphrase the master key is wrapped with: the agent's signature
+// over `challenge`.  It is checked to be deterministic, which rules out
+// ECDSA keys.
+func sshAgentSecret(signer gossh.Signer, challenge []byte) (string, error) {
+	first, err := signer.Sign(rand.Reader, challenge)
+	if err != nil {
+		return "", err
+	}
+
+	second, err := signer.Sign(rand.Reader, challenge)
+	if err != nil {
+		return "", err
+	}
+
+	if !bytes.Equal(first.Blob, second.Blob) {
+		return "", errors.New("Unsupported key for ssh-agent unlock, its signatures are not deterministic: " + signer.PublicKey().Type())
+	}
+	return string(first.Blob), nil
+}
+
+func (vu *VaultUser) agentChallengeFile() string {
+	return path.Join(vu.path, "agent_challenge")
+}
+
+func (vu *VaultUser) agentMasterFile() string {
+	return path.Join(vu.path, "agent_master")
+}
+
+// binds the wrapped key to the user it belongs to
+func (vu *VaultUser) agentAssociatedData() []byte {
+	return []byte("ssh-agent\x00" + vu.email)
+}
+
+//
+// HasSshAgent returns true if the user can unlock the vault through
+// ssh-agent.
+//
+func (vu *VaultUser) HasSshAgent() bool {
+	return vu.agentMasterKey != ""
+}
+
+//
+// EnrollSshAgent wraps `masterKey` with a new challenge signed by `signer`.
+//
+func (vu *VaultUser) EnrollSshAgent(signer gossh.Signer, masterKey []byte) error {
+	challenge, err := GenRandomIv(agentChallengeSize)
+	if err != nil {
+		return err
+	}
+
+	secret, err := sshAgentSecret(signer, challenge)
+	if err != nil {
+		return err
+	}
+
+	wrapped, err := EncryptWithAD(secret, masterKey, vu.agentAssociatedData())
+	if err != nil {
+		return err
+	}
+
+	vu.agentChallenge = base64.StdEncoding.EncodeToString(challenge)
+	vu.agentMasterKey = base64.StdEncoding.EncodeToString(wrapped)
+	return nil
+}
+
+// unwraps `wrapped` with the signature of `signer` over `challenge`, both
+// base64 encoded as stored in users/<email>/.
+func (vu *VaultUser) unwrapWithSshAgent(signer gossh.Signer, challenge string, wrapped string) ([]byte, error) {
+	rawChallenge, err := base64.StdEncoding.DecodeString(challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	rawWrapped, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := sshAgentSecret(signer, rawChallenge)
+	if err != nil {
+		return nil, err
+	}
+
+	masterKey, _, err := DecryptWithAD(secret, rawWrapped, vu.agentAssociatedData())
+	return masterKey, err
+}
+
+//
+// UnlockMasterKeyWithSshAgent unwraps the vault master key with a fresh
+// signature from `signer`.
+//
+func (vu *VaultUser) UnlockMasterKeyWithSshAgent(signer gossh.Signer) ([]byte, error) {
+	if !vu.HasSshAgent() {
+		return nil, errors.New("ssh-agent unlock is not set up for this vault; run `passward vault enroll-agent`")
+	}
+	return vu.unwrapWithSshAgent(signer, vu.agentChallenge, vu.agentMasterKey)
+}
+
+//
+// SshAgentEnrolled returns true if the current user can unlock the vault
+// through ssh-agent.
+//
+func (v *Vault) SshAgentEnrolled() bool {
+	user := v.users.LookupByEmail(v.credentials.Email)
+	return user != nil && user.HasSshAgent()
+}
+
+// drops the ssh-agent wrapping, which can't follow a new master key
+func (vu *VaultUser) clearSshAgent() {
+	vu.agentChallenge = ""
+	vu.agentMasterKey = ""
+}
+
+// reads the ssh-agent files of the user, if any
+func (vu *VaultUser) readSshAgent() error {
+	if !util.FileExists(vu.agentMasterFile()) {
+		return nil
+	}
+
+	challenge, err := ioutil.ReadFile(vu.agentChallengeFile())
+	if err != nil {
+		return err
+	}
+
+	wrapped, err := ioutil.ReadFile(vu.agentMasterFile())
+	if err != nil {
+		return err
+	}
+
+	vu.agentChallenge = string(challenge)
+	vu.agentMasterKey = string(wrapped)
+	return nil
+}
+
+// writes the ssh-agent files, or removes them if the user isn't enrolled
+func (vu *VaultUser) saveSshAgent() error {
+	if !vu.HasSshAgent() {
+		for _, file := range []string{vu.agentChallengeFile(), vu.agentMasterFile()} {
+			if util.FileExists(file) {
+				if err := os.Remove(file); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	if err := ioutil.WriteFile(vu.agentChallengeFile(), []byte(vu.agentChallenge), 0600); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(vu.agentMasterFile(), []byte(vu.agentMasterKey), 0600)
+}
+
+//
+// NewSshAgentKeyRing builds a key ring whose private key stays in
+// ssh-agent.  It can sign, but not decrypt; vaults are unlocked with
+// `VaultUser.UnlockMasterKeyWithSshAgent` instead.
+//
+func NewSshAgentKeyRing(publicKeyPath string) (*SshKeyRing, error) {
+	ssh := SshKeyRing{PublicKeyPath: publicKeyPath, fromAgent: true}
+
+	if err := ssh.ParsePublicKey(); err != nil {
+		return nil, err
+	}
+
+	signer, err := sshAgentSigner(ssh.publicKeyString)
+	if err != nil {
+		return nil, err
+	}
+	ssh.signer = signer
+	ssh.agentSocket = os.Getenv("SSH_AUTH_SOCK")
+	return &ssh, nil
+}
+
+//
+// EnrollSshAgent lets the current user unlock the vault through ssh-agent
+// from now on.  The keys must be unlocked with the private key file, since
+// the master key has to be decrypted once.
+//
+func (v *Vault) EnrollSshAgent() error {
+	masterKey, err := v.unlockForWrite()
+	if err != nil {
+		return err
+	}
+
+	signer, err := sshAgentSigner(v.credentials.PublicKeyString())
+	if err != nil {
+		return err
+	}
+
+	user := v.users.LookupByEmail(v.credentials.Email)
+	if err := user.EnrollSshAgent(signer, masterKey); err != nil {
+		return err
+	}
+
+	if err := user.Save(); err != nil {
+		return err
+	}
+
+	return v.Save("Enrolled ssh-agent unlock for: " + v.credentials.Email)
+}
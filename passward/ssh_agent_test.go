@@ -0,0 +1,82 @@
+package passward
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func TestSshAgentUnlock(t *testing.T) {
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: privateKey}); err != nil {
+		t.Fatal(err)
+	}
+	signers, err := keyring.Signers()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := &VaultUser{email: "bob@foo.com"}
+	masterKey := []byte("my master key")
+
+	if err := user.EnrollSshAgent(signers[0], masterKey); err != nil {
+		t.Fatal(err)
+	}
+
+	unlocked, err := user.UnlockMasterKeyWithSshAgent(signers[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(unlocked, masterKey) {
+		t.Fatal("mismatch:", string(unlocked))
+	}
+
+	// the key file signs the same way, which is how a key rotation enrolls
+	// the caller again
+	fileSigner, err := gossh.NewSignerFromKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unlocked, err := user.UnlockMasterKeyWithSshAgent(fileSigner); err != nil || !bytes.Equal(unlocked, masterKey) {
+		t.Fatal("expected the key file to unwrap the master key:", err)
+	}
+
+	other := &VaultUser{email: "eve@foo.com", agentChallenge: user.agentChallenge, agentMasterKey: user.agentMasterKey}
+	if _, err := other.UnlockMasterKeyWithSshAgent(signers[0]); err == nil {
+		t.Fatal("expected a wrapped key copied to another user to fail")
+	}
+}
+
+func TestSshAgentRejectsEcdsa(t *testing.T) {
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: privateKey}); err != nil {
+		t.Fatal(err)
+	}
+	signers, err := keyring.Signers()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := &VaultUser{email: "bob@foo.com"}
+	if err := user.EnrollSshAgent(signers[0], []byte("my master key")); err == nil {
+		t.Fatal("expected ECDSA keys to be rejected")
+	}
+}
@@ -0,0 +1,283 @@
+package passward
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"io"
+	"math/big"
+
+	"github.com/jandre/sshcrypt"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/nacl/box"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+//
+// Public key encryption for each kind of ssh key.  RSA keys go through
+// sshcrypt, as they always have.  Ed25519 keys are converted to X25519 and
+// used with a libsodium-compatible sealed box.  ECDSA keys use ECIES:
+// ECDH with an ephemeral key, HKDF-SHA256 and AES-256-GCM.
+//
+
+type sshEncrypter interface {
+	EncryptBytes([]byte) ([]byte, error)
+}
+
+type sshDecrypter interface {
+	DecryptBytes([]byte) ([]byte, error)
+}
+
+//
+// IsSupportedKeyType returns true if keys of type `keyType`, e.g.
+// "ssh-ed25519", can be used to encrypt vaults.
+//
+func IsSupportedKeyType(keyType string) bool {
+	switch keyType {
+	case gossh.KeyAlgoRSA, gossh.KeyAlgoED25519,
+		gossh.KeyAlgoECDSA256, gossh.KeyAlgoECDSA384, gossh.KeyAlgoECDSA521:
+		return true
+	}
+	return false
+}
+
+// parses an authorized_keys formatted public key for encryption
+func parseEncryptionKey(authorizedKey []byte) (sshEncrypter, error) {
+	key, _, _, _, err := gossh.ParseAuthorizedKey(authorizedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if key.Type() == gossh.KeyAlgoRSA {
+		rsaKey, _, _, _, err := sshcrypt.ParseAuthorizedKey(authorizedKey)
+		return rsaKey, err
+	}
+
+	cryptoKey, ok := key.(gossh.CryptoPublicKey)
+	if !ok {
+		return nil, errors.New("Unsupported key type: " + key.Type())
+	}
+
+	switch pub := cryptoKey.CryptoPublicKey().(type) {
+	case ed25519.PublicKey:
+		return newX25519Key(pub, nil)
+	case *ecdsa.PublicKey:
+		return &eciesKey{public: pub}, nil
+	}
+	return nil, errors.New("Unsupported key type: " + key.Type())
+}
+
+// parses a PEM or OpenSSH private key, decrypting it with `passphrase` if
+// it is encrypted
+func parseRawPrivateKey(pemBytes []byte, passphrase string) (interface{}, error) {
+	raw, err := gossh.ParseRawPrivateKey(pemBytes)
+	if _, ok := err.(*gossh.PassphraseMissingError); ok {
+		return gossh.ParseRawPrivateKeyWithPassphrase(pemBytes, []byte(passphrase))
+	}
+	return raw, err
+}
+
+// returns the decrypter of `raw`, the private key parsed from `pemBytes`
+func parseDecryptionKey(raw interface{}, pemBytes []byte, passphrase string) (sshDecrypter, error) {
+	switch priv := raw.(type) {
+	case *rsa.PrivateKey:
+		return sshcrypt.ParsePrivateKey(pemBytes, passphrase)
+	case ed25519.PrivateKey:
+		return newX25519Key(priv.Public().(ed25519.PublicKey), priv)
+	case *ed25519.PrivateKey:
+		return newX25519Key(priv.Public().(ed25519.PublicKey), *priv)
+	case *ecdsa.PrivateKey:
+		return &eciesKey{public: &priv.PublicKey, private: priv}, nil
+	}
+	return nil, errors.New("Unsupported private key type")
+}
+
+//
+// x25519Key encrypts with an Ed25519 key converted to X25519.
+//
+type x25519Key struct {
+	public  [32]byte
+	private *[32]byte
+}
+
+// the prime of curve25519, 2^255 - 19
+var curve25519P, _ = new(big.Int).SetString("7fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffed", 16)
+
+// maps the Edwards y coordinate of `pub` to the Montgomery u coordinate,
+// u = (1 + y) / (1 - y) mod p, as libsodium's crypto_sign_ed25519_pk_to_curve25519
+func ed25519PublicToX25519(pub ed25519.PublicKey) ([32]byte, error) {
+	var out [32]byte
+	if len(pub) != ed25519.PublicKeySize {
+		return out, errors.New("Invalid ed25519 public key")
+	}
+
+	// y is stored little endian with the sign bit of x on top; reverse it
+	// to big endian for big.Int, without the sign bit
+	yBytes := make([]byte, 32)
+	for i := range yBytes {
+		yBytes[i] = pub[31-i]
+	}
+	yBytes[0] &= 0x7f
+	y := new(big.Int).SetBytes(yBytes)
+
+	one := big.NewInt(1)
+	num := new(big.Int).Add(one, y)
+	den := new(big.Int).Sub(one, y)
+	den.Mod(den, curve25519P)
+	if den.Sign() == 0 {
+		return out, errors.New("Invalid ed25519 public key")
+	}
+
+	u := num.Mul(num, den.ModInverse(den, curve25519P))
+	u.Mod(u, curve25519P)
+
+	be := u.Bytes()
+	for i := range be {
+		out[i] = be[len(be)-1-i]
+	}
+	return out, nil
+}
+
+// the X25519 scalar of an Ed25519 key is the clamped first half of the
+// SHA-512 of its seed
+func ed25519PrivateToX25519(priv ed25519.PrivateKey) *[32]byte {
+	var out [32]byte
+	h := sha512.Sum512(priv.Seed())
+	copy(out[:], h[:32])
+	out[0] &= 248
+	out[31] &= 127
+	out[31] |= 64
+	return &out
+}
+
+func newX25519Key(pub ed25519.PublicKey, priv ed25519.PrivateKey) (*x25519Key, error) {
+	public, err := ed25519PublicToX25519(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &x25519Key{public: public}
+	if priv != nil {
+		key.private = ed25519PrivateToX25519(priv)
+
+		var derived [32]byte
+		curve25519.ScalarBaseMult(&derived, key.private)
+		if derived != key.public {
+			return nil, errors.New("ed25519 private key does not match its public key")
+		}
+	}
+	return key, nil
+}
+
+func (k *x25519Key) EncryptBytes(data []byte) ([]byte, error) {
+	return box.SealAnonymous(nil, data, &k.public, rand.Reader)
+}
+
+func (k *x25519Key) DecryptBytes(data []byte) ([]byte, error) {
+	if k.private == nil {
+		return nil, errors.New("No private key to decrypt with")
+	}
+
+	plain, ok := box.OpenAnonymous(nil, data, &k.public, k.private)
+	if !ok {
+		return nil, errors.New("Unable to decrypt sealed box")
+	}
+	return plain, nil
+}
+
+//
+// eciesKey encrypts with an ECDSA key.  A ciphertext is the ephemeral
+// public key (uncompressed), the GCM nonce, and the sealed data.
+//
+type eciesKey struct {
+	public  *ecdsa.PublicKey
+	private *ecdsa.PrivateKey
+}
+
+const eciesInfo = "passward ecies aes-256-gcm"
+
+// derives the AES key from the shared x coordinate, bound to the ephemeral
+// public key
+func eciesDeriveKey(curve elliptic.Curve, sharedX *big.Int, ephemeral []byte) ([]byte, error) {
+	size := (curve.Params().BitSize + 7) / 8
+	shared := make([]byte, size)
+	x := sharedX.Bytes()
+	copy(shared[size-len(x):], x)
+
+	key := make([]byte, aes256Size)
+	kdf := hkdf.New(sha256.New, shared, ephemeral, []byte(eciesInfo))
+	if _, err := io.ReadFull(kdf, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (k *eciesKey) EncryptBytes(data []byte) ([]byte, error) {
+	curve := k.public.Curve
+
+	ephemeral, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	ephemeralBytes := elliptic.Marshal(curve, ephemeral.X, ephemeral.Y)
+
+	sharedX, _ := curve.ScalarMult(k.public.X, k.public.Y, ephemeral.D.Bytes())
+	key, err := eciesDeriveKey(curve, sharedX, ephemeralBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	mode, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := GenRandomIv(mode.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+
+	out := append(ephemeralBytes, nonce...)
+	return mode.Seal(out, nonce, data, nil), nil
+}
+
+func (k *eciesKey) DecryptBytes(data []byte) ([]byte, error) {
+	if k.private == nil {
+		return nil, errors.New("No private key to decrypt with")
+	}
+	curve := k.public.Curve
+
+	pointSize := 1 + 2*((curve.Params().BitSize+7)/8)
+	if len(data) < pointSize {
+		return nil, errors.New("ECIES ciphertext too short")
+	}
+
+	ephemeralBytes := data[:pointSize]
+	x, y := elliptic.Unmarshal(curve, ephemeralBytes)
+	if x == nil {
+		return nil, errors.New("Invalid ECIES ephemeral key")
+	}
+
+	sharedX, _ := curve.ScalarMult(x, y, k.private.D.Bytes())
+	key, err := eciesDeriveKey(curve, sharedX, ephemeralBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	mode, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	rest := data[pointSize:]
+	if len(rest) < mode.NonceSize() {
+		return nil, errors.New("ECIES ciphertext too short")
+	}
+	return mode.Open(nil, rest[:mode.NonceSize()], rest[mode.NonceSize():], nil)
+}
@@ -0,0 +1,186 @@
+package passward
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func testRoundTrip(t *testing.T, pub interface{}, decrypter sshDecrypter) {
+	sshKey, err := gossh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypter, err := parseEncryptionKey(gossh.MarshalAuthorizedKey(sshKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("my master key")
+	encrypted, err := encrypter.EncryptBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decrypted, err := decrypter.DecryptBytes(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, data) {
+		t.Fatal("mismatch:", string(decrypted))
+	}
+
+	encrypted[len(encrypted)-1] ^= 1
+	if _, err := decrypter.DecryptBytes(encrypted); err == nil {
+		t.Fatal("expected a modified ciphertext to fail")
+	}
+}
+
+func TestEd25519Encryption(t *testing.T) {
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// also checks the converted public key matches the converted private key
+	decrypter, err := newX25519Key(pub, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testRoundTrip(t, pub, decrypter)
+}
+
+func TestEcdsaEncryption(t *testing.T) {
+
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		priv, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		testRoundTrip(t, &priv.PublicKey, &eciesKey{public: &priv.PublicKey, private: priv})
+	}
+}
+
+// writes `block` and the public key `pub` to `dir`, and reads them back
+// with the passphrase
+func testKeyFiles(t *testing.T, dir string, name string, pub interface{}, block *pem.Block, passphrase string) *SshKeyRing {
+	sshKey, err := gossh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privateKeyPath := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(privateKeyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(privateKeyPath+".pub", gossh.MarshalAuthorizedKey(sshKey), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if passphrase != "" {
+		if _, err := NewSshKeyRing(privateKeyPath+".pub", privateKeyPath, "wrong"); err == nil {
+			t.Fatal("expected a wrong passphrase to fail for", name)
+		}
+	}
+
+	keys, err := NewSshKeyRing(privateKeyPath+".pub", privateKeyPath, passphrase)
+	if err != nil {
+		t.Fatal(name, err)
+	}
+	return keys
+}
+
+func TestParsePrivateKeyFiles(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecPriv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rings := make([]*SshKeyRing, 0)
+
+	// ssh-keygen's default OpenSSH format, with and without a passphrase
+	block, err := gossh.MarshalPrivateKeyWithPassphrase(edPriv, "", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rings = append(rings, testKeyFiles(t, dir, "id_ed25519", edPub, block, "secret"))
+
+	block, err = gossh.MarshalPrivateKey(ecPriv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rings = append(rings, testKeyFiles(t, dir, "id_ecdsa", &ecPriv.PublicKey, block, ""))
+
+	// the older PEM format
+	der, err := x509.MarshalECPrivateKey(ecPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rings = append(rings, testKeyFiles(t, dir, "id_ecdsa_pem", &ecPriv.PublicKey,
+		&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}, ""))
+
+	for _, keys := range rings {
+		encrypted, err := keys.EncryptAndBase64([]byte("my master key"))
+		if err != nil {
+			t.Fatal(keys.PrivateKeyPath, err)
+		}
+
+		decrypted, err := keys.DecryptBase64(encrypted)
+		if err != nil {
+			t.Fatal(keys.PrivateKeyPath, err)
+		}
+		if string(decrypted) != "my master key" {
+			t.Fatal("mismatch:", keys.PrivateKeyPath, string(decrypted))
+		}
+	}
+}
+
+func TestReadVaultUserRejectsBadKey(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	user := &VaultUser{path: filepath.Join(dir, "bob@foo.com")}
+	if err := os.MkdirAll(user.path, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(user.publicKeyFile(), []byte("ssh-ed25519 AAAAnotakey bob@foo.com\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(user.encryptedMasterFile(), []byte("master"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ReadVaultUser(user.path); err == nil {
+		t.Fatal("expected an unparseable public key to fail")
+	}
+}
@@ -1,7 +1,9 @@
 package passward
 
 import (
+	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -9,7 +11,7 @@ import (
 	"path/filepath"
 
 	"github.com/jandre/passward/util"
-	"github.com/jandre/sshcrypt"
+	gossh "golang.org/x/crypto/ssh"
 )
 
 //
@@ -19,11 +21,40 @@ type SshKeyRing struct {
 	PublicKeyPath  string
 	PrivateKeyPath string
 
-	privateKey sshcrypt.PrivateKey
-	publicKey  sshcrypt.PublicKey
+	privateKey sshDecrypter
+	publicKey  sshEncrypter
+	signer     gossh.Signer
 
 	publicKeyString  string
 	privateKeyString string
+
+	// the decrypted private key, as parsed by x/crypto/ssh
+	rawPrivateKey interface{}
+
+	// the private key is in ssh-agent, see NewSshAgentKeyRing
+	fromAgent bool
+
+	// the ssh-agent protocol socket holding the private key, if any; see
+	// NewSshAgentKeyRing and NewAgentKeyRing
+	agentSocket string
+
+	// e.g. "ssh-ed25519", set once the public key is read
+	keyType string
+}
+
+//
+// FromSshAgent returns true if the private key is held by ssh-agent.
+//
+func (s *SshKeyRing) FromSshAgent() bool {
+	return s.fromAgent
+}
+
+//
+// AgentSocket returns the ssh-agent protocol socket that holds the private
+// key, or "" if the key was read from its file.
+//
+func (s *SshKeyRing) AgentSocket() string {
+	return s.agentSocket
 }
 
 func (s *SshKeyRing) PublicKeyString() string {
@@ -31,6 +62,10 @@ func (s *SshKeyRing) PublicKeyString() string {
 }
 
 func (s *SshKeyRing) DecryptBase64(base64str string) ([]byte, error) {
+	if s.privateKey == nil {
+		return nil, errors.New("Unable to decrypt, the private key is held by ssh-agent")
+	}
+
 	data, err := base64.StdEncoding.DecodeString(base64str)
 	if err != nil {
 		return nil, err
@@ -71,7 +106,18 @@ func NewSshKeyRing(publicKeyPath string, privateKeyPath string, passphrase strin
 // Get description string
 //
 func (s *SshKeyRing) GetDescription() string {
-	return fmt.Sprintf("%s (Public), %s (Private)", s.PublicKeyPath, s.PrivateKeyPath)
+	desc := fmt.Sprintf("%s (Public), %s (Private)", s.PublicKeyPath, s.PrivateKeyPath)
+	if s.keyType != "" && !s.Supported() {
+		desc += " - unsupported key type: " + s.keyType
+	}
+	return desc
+}
+
+//
+// Supported returns true if the key type can be used to encrypt vaults.
+//
+func (s *SshKeyRing) Supported() bool {
+	return IsSupportedKeyType(s.keyType)
 }
 
 // validates public key is ok and works with private key
@@ -83,13 +129,18 @@ func (s *SshKeyRing) ParsePublicKey() error {
 		return err
 	}
 
-	ret, comment, opts, _, err := sshcrypt.ParseAuthorizedKey(keyBytes)
+	key, comment, opts, _, err := gossh.ParseAuthorizedKey(keyBytes)
 
 	if err != nil {
 		return err
 	}
 	debug("read key with comment: %s, %s", comment, opts)
-	s.publicKey = ret
+
+	s.publicKey, err = parseEncryptionKey(keyBytes)
+	if err != nil {
+		return err
+	}
+	s.keyType = key.Type()
 	s.publicKeyString = string(keyBytes)
 
 	return nil
@@ -99,7 +150,7 @@ func (s *SshKeyRing) ParsePublicKey() error {
 // ParsePrivateKey will parse a private key.
 // Private keys in ssh are PEM-encoded blocks. Attempt to decode
 //
-// TODO: supports RSA only, add other support.
+// RSA, Ed25519 and ECDSA keys are supported, see ssh_crypt.go.
 //
 func (s *SshKeyRing) ParsePrivateKey(passphrase string) error {
 
@@ -109,24 +160,100 @@ func (s *SshKeyRing) ParsePrivateKey(passphrase string) error {
 		return err
 	}
 
-	s.privateKey, err = sshcrypt.ParsePrivateKey(encryptedBytes, passphrase)
+	raw, err := parseRawPrivateKey(encryptedBytes, passphrase)
 
 	if err != nil {
 		return err
+	}
 
+	s.privateKey, err = parseDecryptionKey(raw, encryptedBytes, passphrase)
+
+	if err != nil {
+		return err
+
+	}
+
+	// the signer is used to sign vault commits
+	s.signer, err = gossh.NewSignerFromKey(raw)
+
+	if err != nil {
+		return err
 	}
+	s.rawPrivateKey = raw
 	s.privateKeyString = string(encryptedBytes)
 
 	return nil
 }
 
+//
+// Sign signs `data` with the private key, and returns the base64 encoded
+// ssh signature.
+//
+func (s *SshKeyRing) Sign(data []byte) (string, error) {
+	var sig *gossh.Signature
+	var err error
+
+	if s.signer == nil {
+		return "", errors.New("private key has not been parsed")
+	}
+
+	algorithmSigner, ok := s.signer.(gossh.AlgorithmSigner)
+	if ok && s.signer.PublicKey().Type() == gossh.KeyAlgoRSA {
+		// prefer SHA-256 over the SHA-1 default for RSA keys
+		sig, err = algorithmSigner.SignWithAlgorithm(rand.Reader, data, gossh.KeyAlgoRSASHA256)
+	} else {
+		sig, err = s.signer.Sign(rand.Reader, data)
+	}
+
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gossh.Marshal(sig)), nil
+}
+
+//
+// VerifySshSignature checks a signature made by `Sign` against the
+// authorized_keys formatted `publicKey`.
+//
+func VerifySshSignature(publicKey string, data []byte, signature string) error {
+	var sig gossh.Signature
+
+	key, _, _, _, err := gossh.ParseAuthorizedKey([]byte(publicKey))
+	if err != nil {
+		return err
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return err
+	}
+
+	if err := gossh.Unmarshal(raw, &sig); err != nil {
+		return err
+	}
+	return key.Verify(data, &sig)
+}
+
 func GetSshKeyRingPath() string {
 	home := os.Getenv("HOME")
 	return path.Join(home, ".ssh")
 }
 
+// reads the type of the public key, leaving it empty if it can't be read
+func (s *SshKeyRing) detectKeyType() {
+	keyBytes, err := ioutil.ReadFile(s.PublicKeyPath)
+	if err != nil {
+		return
+	}
+
+	if key, _, _, _, err := gossh.ParseAuthorizedKey(keyBytes); err == nil {
+		s.keyType = key.Type()
+	}
+}
+
 //
-// list all ssh keys in ~/.ssh
+// list all ssh keys in ~/.ssh; see `Supported` for the ones that can be
+// used.
 //
 func DetectSshKeyRing(sshKeysPath string) []*SshKeyRing {
 	keys := make([]*SshKeyRing, 0)
@@ -142,6 +269,7 @@ func DetectSshKeyRing(sshKeysPath string) []*SshKeyRing {
 			privateKeyFile := pubKeyFile[:len(pubKeyFile)-4]
 			if util.FileExists(privateKeyFile) {
 				key := &SshKeyRing{PublicKeyPath: pubKeyFile, PrivateKeyPath: privateKeyFile}
+				key.detectKeyType()
 				keys = append(keys, key)
 			}
 		}
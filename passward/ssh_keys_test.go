@@ -0,0 +1,56 @@
+package passward
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestSignVerify(t *testing.T) {
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := gossh.NewSignerFromKey(privateKey)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring := &SshKeyRing{signer: signer}
+	publicKey := string(gossh.MarshalAuthorizedKey(signer.PublicKey()))
+
+	signature, err := keyring.Sign([]byte("tree 1234"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := VerifySshSignature(publicKey, []byte("tree 1234"), signature); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := VerifySshSignature(publicKey, []byte("tree 5678"), signature); err == nil {
+		t.Fatal("expected signature over different data to fail")
+	}
+}
+
+func TestSplitSignedMessage(t *testing.T) {
+
+	msg, signature := SplitSignedMessage("New entry: foo" + signatureTrailer + "c2lnbmF0dXJl\n")
+
+	if msg != "New entry: foo" || signature != "c2lnbmF0dXJl" {
+		t.Fatal("mismatch:", msg, signature)
+	}
+
+	msg, signature = SplitSignedMessage("New vault created.")
+
+	if msg != "New vault created." || signature != "" {
+		t.Fatal("mismatch:", msg, signature)
+	}
+}
@@ -0,0 +1,180 @@
+package passward
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// name of the field holding a TOTP secret
+const TotpField = "totp"
+
+//
+// Totp holds the settings of an RFC 6238 time-based one-time password.
+//
+type Totp struct {
+	Secret    []byte
+	Algorithm string
+	Digits    int
+	Period    int
+}
+
+func decodeTotpSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.Replace(secret, " ", "", -1))
+	secret = strings.TrimRight(secret, "=")
+	if pad := len(secret) % 8; pad != 0 {
+		secret += strings.Repeat("=", 8-pad)
+	}
+
+	bytes, err := base32.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return nil, errors.New("Invalid TOTP secret, expected base32: " + err.Error())
+	}
+	if len(bytes) == 0 {
+		return nil, errors.New("Empty TOTP secret.")
+	}
+	return bytes, nil
+}
+
+//
+// ParseTotp reads either an otpauth://totp/ URI, or a bare base32 secret
+// which uses the defaults of SHA1, 6 digits and 30 seconds.
+//
+func ParseTotp(value string) (*Totp, error) {
+	value = strings.TrimSpace(value)
+	totp := &Totp{Algorithm: "SHA1", Digits: 6, Period: 30}
+
+	if !strings.HasPrefix(strings.ToLower(value), "otpauth:") {
+		secret, err := decodeTotpSecret(value)
+		if err != nil {
+			return nil, err
+		}
+		totp.Secret = secret
+		return totp, nil
+	}
+
+	uri, err := url.Parse(value)
+	if err != nil {
+		return nil, err
+	}
+	if strings.ToLower(uri.Host) != "totp" {
+		return nil, errors.New("Unsupported otpauth type, only totp is supported: " + uri.Host)
+	}
+
+	query := uri.Query()
+	if totp.Secret, err = decodeTotpSecret(query.Get("secret")); err != nil {
+		return nil, err
+	}
+
+	if algorithm := query.Get("algorithm"); algorithm != "" {
+		totp.Algorithm = strings.ToUpper(algorithm)
+	}
+
+	if digits := query.Get("digits"); digits != "" {
+		if totp.Digits, err = strconv.Atoi(digits); err != nil {
+			return nil, errors.New("Invalid TOTP digits: " + digits)
+		}
+	}
+
+	if period := query.Get("period"); period != "" {
+		if totp.Period, err = strconv.Atoi(period); err != nil || totp.Period <= 0 {
+			return nil, errors.New("Invalid TOTP period: " + period)
+		}
+	}
+
+	return totp, totp.validate()
+}
+
+func (t *Totp) validate() error {
+	if _, err := t.hash(); err != nil {
+		return err
+	}
+	if t.Digits != 6 && t.Digits != 8 {
+		return fmt.Errorf("Unsupported TOTP digits, expected 6 or 8: %d", t.Digits)
+	}
+	return nil
+}
+
+func (t *Totp) hash() (func() hash.Hash, error) {
+	switch t.Algorithm {
+	case "SHA1":
+		return sha1.New, nil
+	case "SHA256":
+		return sha256.New, nil
+	case "SHA512":
+		return sha512.New, nil
+	}
+	return nil, errors.New("Unsupported TOTP algorithm: " + t.Algorithm)
+}
+
+//
+// Code returns the one-time password for `now`, and how long it stays valid.
+//
+func (t *Totp) Code(now time.Time) (string, time.Duration, error) {
+	if err := t.validate(); err != nil {
+		return "", 0, err
+	}
+
+	h, _ := t.hash()
+	counter := now.Unix() / int64(t.Period)
+
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(counter))
+
+	mac := hmac.New(h, t.Secret)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	// dynamic truncation, RFC 4226 section 5.3
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < t.Digits; i++ {
+		mod *= 10
+	}
+
+	next := time.Unix((counter+1)*int64(t.Period), 0)
+	return fmt.Sprintf("%0*d", t.Digits, value%mod), next.Sub(now), nil
+}
+
+//
+// TotpCode returns the current one-time password of the entry `site`, and
+// how long it stays valid.
+//
+func (v *Vault) TotpCode(site string) (string, time.Duration, error) {
+	key, err := v.unlockMasterKey()
+	if err != nil {
+		return "", 0, err
+	}
+
+	entry := v.entries.Get(site)
+	if entry == nil {
+		return "", 0, errors.New("No entry found: " + site)
+	}
+
+	if _, ok := entry.encryptedValues[TotpField]; !ok {
+		return "", 0, errors.New("No totp field found in entry: " + site)
+	}
+
+	value, err := entry.Reveal(TotpField, key)
+	if err != nil {
+		return "", 0, err
+	}
+
+	totp, err := ParseTotp(value)
+	if err != nil {
+		return "", 0, err
+	}
+	return totp.Code(time.Now())
+}
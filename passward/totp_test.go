@@ -0,0 +1,62 @@
+package passward
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// test vectors from RFC 6238, appendix B
+func TestTotpCode(t *testing.T) {
+
+	secrets := map[string]string{
+		"SHA1":   "12345678901234567890",
+		"SHA256": "12345678901234567890123456789012",
+		"SHA512": "1234567890123456789012345678901234567890123456789012345678901234",
+	}
+
+	vectors := []struct {
+		when      int64
+		algorithm string
+		code      string
+	}{
+		{59, "SHA1", "94287082"},
+		{59, "SHA256", "46119246"},
+		{59, "SHA512", "90693936"},
+		{1111111109, "SHA1", "07081804"},
+		{2000000000, "SHA256", "90698825"},
+		{20000000000, "SHA512", "47863826"},
+	}
+
+	for _, vector := range vectors {
+		secret := base32.StdEncoding.EncodeToString([]byte(secrets[vector.algorithm]))
+		totp, err := ParseTotp("otpauth://totp/test?secret=" + secret + "&algorithm=" + vector.algorithm + "&digits=8")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		code, _, err := totp.Code(time.Unix(vector.when, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != vector.code {
+			t.Fatal("mismatch at", vector.when, vector.algorithm, code, vector.code)
+		}
+	}
+}
+
+func TestParseTotpSecret(t *testing.T) {
+
+	totp, err := ParseTotp("jbsw y3dp ehpk 3pxp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(totp.Secret) != "Hello!\xde\xad\xbe\xef" || totp.Digits != 6 || totp.Period != 30 {
+		t.Fatal("unexpected totp:", totp)
+	}
+
+	if _, err := ParseTotp("otpauth://hotp/test?secret=JBSWY3DPEHPK3PXP"); err == nil {
+		t.Fatal("expected hotp to be rejected")
+	}
+}
@@ -3,10 +3,14 @@ package passward
 import (
 	"crypto/rand"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/jandre/passward/util"
@@ -15,8 +19,17 @@ import (
 const KEYSIZE = 128
 
 type Vault struct {
-	Name        string
-	Description string
+	Name            string
+	Description     string
+	LastKeyRotation time.Time
+	// EncryptedNames stores entries under opaque ids, see vault_index.go
+	EncryptedNames bool
+	// MinCipherVersion is the oldest ciphertext version accepted, set by
+	// `Upgrade` once every secret has been rewritten.
+	MinCipherVersion byte
+	// SignedAfter is the last commit made before the vault's commits were
+	// signed, set by `Upgrade`.  Every commit after it must be signed.
+	SignedAfter string
 	Path        string `toml:"-"`
 
 	// secret entries
@@ -29,21 +42,130 @@ type Vault struct {
 }
 
 //
-// RemoveUser removes a user from the vault with an email `email`
+// RemoveUser removes a user from the vault with an email `email`.
+//
+// The removed user has already seen the master key, so a new master key is
+// generated, every entry is re-encrypted with it and it is wrapped for the
+// remaining users, all in the same commit.
 //
 func (v *Vault) RemoveUser(email string) error {
-	err := v.users.removeByEmail(email)
+	if email == v.credentials.Email {
+		return errors.New("Unable to remove yourself from the vault: " + email)
+	}
 
+	oldKey, err := v.unlockForWrite()
 	if err != nil {
-		debug("unable to remove user: %s", err)
 		return err
 	}
 
-	v.Save("Remove user: " + email)
+	if v.users.LookupByEmail(email) == nil {
+		return errors.New("No user found to remove:" + email)
+	}
+
+	if err := v.rewrapMasterKey(oldKey, email); err != nil {
+		debug("unable to rewrap master key: %s", err)
+		return err
+	}
 
+	if err := v.Save("Remove user: " + email); err != nil {
+		return v.rollback(err)
+	}
 	return nil
 }
 
+//
+// RotateKey replaces the vault master key with a new one, re-encrypting
+// every entry and rewrapping the key for every user.  The rotation date
+// is recorded in the vault config.  ssh-agent enrollments are dropped.
+//
+func (v *Vault) RotateKey() error {
+	oldKey, err := v.unlockForWrite()
+	if err != nil {
+		return err
+	}
+
+	if err := v.rewrapMasterKey(oldKey, ""); err != nil {
+		debug("unable to rewrap master key: %s", err)
+		return err
+	}
+
+	lastKeyRotation := v.LastKeyRotation
+	v.LastKeyRotation = time.Now().UTC()
+
+	err = v.saveConfig()
+	if err == nil {
+		err = v.Save("Rotated master key.")
+	}
+	if err != nil {
+		v.LastKeyRotation = lastKeyRotation
+		return v.rollback(err)
+	}
+	return nil
+}
+
+//
+// Upgrade rewrites every secret stored in an older cipher version with the
+// current one, and returns the number of secrets rewritten.  From then on
+// the vault only accepts the current version, see MinCipherVersion.
+//
+// If the history has commits from before vault commits were signed, the
+// current commit is recorded as SignedAfter, so that clones verify only
+// the commits made since.
+//
+func (v *Vault) Upgrade() (int, error) {
+	key, err := v.unlockForWrite()
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, entry := range v.entries.entries {
+		count, err := entry.upgrade(key)
+		if err != nil {
+			debug("unable to upgrade entry %s: %s", entry.Name(), err)
+			return 0, err
+		}
+		total += count
+	}
+
+	signedAfter := v.SignedAfter
+	if signedAfter == "" {
+		unsigned, err := v.git.UnsignedHistory()
+		if err != nil {
+			return 0, err
+		}
+		if unsigned {
+			if signedAfter, err = v.git.headId(); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if total == 0 && v.MinCipherVersion == CurrentCipherVersion && signedAfter == v.SignedAfter {
+		return 0, nil
+	}
+
+	if err := v.entries.Save(); err != nil {
+		return 0, v.rollback(err)
+	}
+
+	minVersion, previousSignedAfter := v.MinCipherVersion, v.SignedAfter
+	v.MinCipherVersion = CurrentCipherVersion
+	v.SignedAfter = signedAfter
+
+	err = v.saveConfig()
+	if err == nil {
+		err = v.Save(fmt.Sprintf("Upgraded %d secrets to cipher version %d.", total, CurrentCipherVersion))
+	}
+	if err != nil {
+		v.MinCipherVersion = minVersion
+		v.SignedAfter = previousSignedAfter
+		return 0, v.rollback(err)
+	}
+
+	return total, v.reload()
+}
+
 func (v *Vault) GetUserByEmail(email string) *VaultUser {
 	return v.users.LookupByEmail(email)
 }
@@ -55,8 +177,15 @@ func (v *Vault) HasRemote() bool {
 	return v.git.HasRemote()
 }
 
+//
+// MergeInProgress returns true if a `Sync` left a merge unfinished.
+//
+func (v *Vault) MergeInProgress() (bool, error) {
+	return v.git.MergeInProgress()
+}
+
 func (v *Vault) AddUser(email string, publicKey string) (*VaultUser, error) {
-	masterKey, err := v.unlockMasterKey()
+	masterKey, err := v.unlockForWrite()
 	if err != nil {
 		debug("could not add user - vault is not unlocked")
 		return nil, err
@@ -81,7 +210,9 @@ func (v *Vault) Entries() map[string]*Entry {
 	return v.entries.entries
 }
 
-func (v *Vault) unlockMasterKey() ([]byte, error) {
+// decrypts the master key of the current user, without reading the
+// entries
+func (v *Vault) unwrapMasterKey() ([]byte, error) {
 
 	keys := v.credentials.GetKeys()
 
@@ -95,7 +226,52 @@ func (v *Vault) unlockMasterKey() ([]byte, error) {
 		return nil, errors.New("No vault user found to unlock passphrase")
 	}
 
-	return user.UnlockMasterKey(keys)
+	var masterKey []byte
+	var err error
+	if keys.FromSshAgent() {
+		masterKey, err = user.UnlockMasterKeyWithSshAgent(keys.signer)
+	} else {
+		masterKey, err = user.UnlockMasterKey(keys)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return masterKey, nil
+}
+
+func (v *Vault) unlockMasterKey() ([]byte, error) {
+	masterKey, err := v.unwrapMasterKey()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := v.entries.Unlock(masterKey); err != nil {
+		return nil, err
+	}
+	v.entries.author = v.credentials.Email
+	return masterKey, nil
+}
+
+// unlocks the master key for a change that will be committed.  Nothing is
+// changed while a merge is unfinished, see ErrMergeInProgress.
+func (v *Vault) unlockForWrite() ([]byte, error) {
+	merging, err := v.git.MergeInProgress()
+	if err != nil {
+		return nil, err
+	}
+	if merging {
+		return nil, ErrMergeInProgress
+	}
+	return v.unlockMasterKey()
+}
+
+//
+// Unlock decrypts the master key, and the entry names if the vault
+// encrypts them.
+//
+func (v *Vault) Unlock() error {
+	_, err := v.unlockMasterKey()
+	return err
 }
 
 func (v *Vault) RevealEntry(name string) (secrets map[string]string, err error) {
@@ -113,17 +289,185 @@ func (v *Vault) RevealEntry(name string) (secrets map[string]string, err error)
 }
 
 func (v *Vault) AddEntry(name string, user string, passphrase string, desc string) error {
+	return v.SetFields(name, map[string]string{
+		"username":    user,
+		"passphrase":  passphrase,
+		"description": desc,
+	})
+}
+
+//
+// SetFields stores each of `fields` in the entry `name`, creating the entry
+// if needed.  Other fields of the entry are left alone.
+//
+func (v *Vault) SetFields(name string, fields map[string]string) error {
+	for field, val := range fields {
+		if err := ValidateField(field, val); err != nil {
+			return err
+		}
+	}
+
+	key, err := v.unlockForWrite()
+	if err != nil {
+		return err
+	}
+
+	isNew := v.entries.Get(name) == nil
+
+	for field, val := range fields {
+		if err := v.entries.Add(name, field, val, key); err != nil {
+			return err
+		}
+	}
+
+	if err := v.entries.Save(); err != nil {
+		return err
+	}
+
+	if isNew {
+		return v.Save("New entry: " + name)
+	}
+	return v.Save(fmt.Sprintf("Updated entry: %s (%s)", name, strings.Join(sortedKeys(fields), ", ")))
+}
+
+//
+// UnsetFields removes the `fields` from the entry `name`.
+//
+func (v *Vault) UnsetFields(name string, fields []string) error {
+	if _, err := v.unlockForWrite(); err != nil {
+		return err
+	}
+
+	entry := v.entries.Get(name)
+	if entry == nil {
+		return errors.New("No entry found:" + name)
+	}
+
+	for _, field := range fields {
+		if _, ok := entry.encryptedValues[field]; !ok {
+			return errors.New("No field found: " + field + " in entry: " + name)
+		}
+		if err := entry.unset(field); err != nil {
+			return err
+		}
+	}
+
+	return v.Save(fmt.Sprintf("Removed fields from entry: %s (%s)", name, strings.Join(fields, ", ")))
+}
+
+//
+// EntryHistory returns the earlier values of the entry `name`, newest first.
+//
+func (v *Vault) EntryHistory(name string) ([]HistoryRecord, error) {
 	key, err := v.unlockMasterKey()
 	if err != nil {
+		return nil, err
+	}
+
+	entry := v.entries.Get(name)
+	if entry == nil {
+		return nil, errors.New("No entry found: " + name)
+	}
+
+	return entry.History(key)
+}
+
+//
+// EditEntry updates the existing entry `name`: each of `fields` whose value
+// differs is set, and each of `removed` is deleted.  It returns the names of
+// the fields that changed, and commits only if there are any.
+//
+func (v *Vault) EditEntry(name string, fields map[string]string, removed []string) ([]string, error) {
+	for field, val := range fields {
+		if err := ValidateField(field, val); err != nil {
+			return nil, err
+		}
+	}
+
+	key, err := v.unlockForWrite()
+	if err != nil {
+		return nil, err
+	}
+
+	entry := v.entries.Get(name)
+	if entry == nil {
+		return nil, errors.New("No entry found: " + name)
+	}
+
+	current, err := entry.RevealAll(key)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make([]string, 0)
+	for _, field := range sortedKeys(fields) {
+		if old, ok := current[field]; ok && old == fields[field] {
+			continue
+		}
+		if err := entry.Set(field, fields[field], key); err != nil {
+			return nil, err
+		}
+		changed = append(changed, field)
+	}
+
+	for _, field := range removed {
+		if _, ok := current[field]; !ok {
+			continue
+		}
+		if err := entry.unset(field); err != nil {
+			return nil, err
+		}
+		changed = append(changed, field)
+	}
+
+	if len(changed) == 0 {
+		return changed, nil
+	}
+
+	if err := v.entries.Save(); err != nil {
+		return nil, err
+	}
+
+	return changed, v.Save(fmt.Sprintf("Edited entry: %s (%s)", name, strings.Join(changed, ", ")))
+}
+
+//
+// RemoveEntry deletes the entry `name` from the vault.
+//
+func (v *Vault) RemoveEntry(name string) error {
+	if _, err := v.unlockForWrite(); err != nil {
+		return err
+	}
+
+	if err := v.entries.Remove(name); err != nil {
 		return err
 	}
-	v.entries.Add(name, "username", user, key)
-	v.entries.Add(name, "passphrase", passphrase, key)
-	v.entries.Add(name, "description", desc, key)
+
 	if err := v.entries.Save(); err != nil {
 		return err
 	}
-	return v.Save("New entry: " + name)
+
+	return v.Save("Removed entry: " + name)
+}
+
+//
+// RenameEntry renames the entry `name` to `newName`.
+//
+func (v *Vault) RenameEntry(name string, newName string) error {
+	key, err := v.unlockForWrite()
+	if err != nil {
+		return err
+	}
+
+	if err := v.entries.Rename(name, newName, key); err != nil {
+		return err
+	}
+
+	if err := v.entries.Save(); err != nil {
+		return err
+	}
+
+	return v.Save("Renamed entry: " + name + " to " + newName)
 }
 
 func ReadAllVaults(vaultPath string, creds *Credentials) (map[string]*Vault, error) {
@@ -163,25 +507,28 @@ func ReadVault(vaultPath string, name string, creds *Credentials) (*Vault, error
 	vault.Path = dst // in case it was moved
 	vault.users = NewVaultUsers(dst)
 	vault.credentials = creds
-	vault.git = NewGit(dst, creds)
-	vault.entries = NewVaultEntries(dst)
+	vault.git = NewGit(dst, creds, newKnownHosts(vaultPath))
+	vault.entries = vault.newEntries()
 	vault.Initialize()
 	return &vault, nil
 }
 
 //
-// Create a new vault.
+// Create a new vault.  If `encryptNames` is set, entry names are kept in an
+// encrypted index instead of in the directory names under keys/.
 //
-func NewVault(vaultPath string, name string, creds *Credentials) (*Vault, error) {
+func NewVault(vaultPath string, name string, creds *Credentials, encryptNames bool) (*Vault, error) {
 	dst := path.Join(vaultPath, name)
 
 	result := Vault{Name: name,
-		Path:        dst,
-		users:       NewVaultUsers(dst),
-		entries:     NewVaultEntries(dst),
-		credentials: creds,
-		git:         NewGit(dst, creds),
+		Path:             dst,
+		EncryptedNames:   encryptNames,
+		MinCipherVersion: CurrentCipherVersion,
+		users:            NewVaultUsers(dst),
+		credentials:      creds,
+		git:              NewGit(dst, creds, newKnownHosts(vaultPath)),
 	}
+	result.entries = result.newEntries()
 
 	if err := result.Initialize(); err != nil {
 		return nil, err
@@ -261,18 +608,129 @@ func (v *Vault) generateKey() ([]byte, error) {
 	return bytes, nil
 }
 
+//
+// rewrapMasterKey generates a new master key, wraps it for every user but
+// `removed`, and then re-encrypts every entry that was encrypted with
+// `oldKey`.  The new key is wrapped for everyone before anything is
+// written, and if writing fails the working tree is restored from HEAD, so
+// the secrets are never left under a key nobody holds.
+//
+func (v *Vault) rewrapMasterKey(oldKey []byte, removed string) error {
+	newKey, err := v.generateKey()
+	if err != nil {
+		return err
+	}
+
+	remaining := make([]*VaultUser, 0, len(v.users.users))
+	for email, user := range v.users.users {
+		if email == removed {
+			continue
+		}
+		if err := user.SetEncryptedMasterKey(newKey); err != nil {
+			debug("unable to wrap master key for %s: %s", email, err)
+			return v.rollback(err)
+		}
+
+		// only the user's own key can wrap the new key for their agent, so
+		// the others enroll again; the caller is enrolled again right away
+		enrolled := user.HasSshAgent()
+		user.clearSshAgent()
+		if enrolled && email == v.credentials.Email {
+			if err := user.EnrollSshAgent(v.credentials.GetKeys().signer, newKey); err != nil {
+				return v.rollback(err)
+			}
+		}
+		remaining = append(remaining, user)
+	}
+
+	if removed != "" {
+		if err := v.users.removeByEmail(removed); err != nil {
+			return v.rollback(err)
+		}
+	}
+
+	if err := v.entries.reencrypt(oldKey, newKey); err != nil {
+		return v.rollback(err)
+	}
+
+	for _, user := range remaining {
+		if err := user.Save(); err != nil {
+			return v.rollback(err)
+		}
+	}
+	return nil
+}
+
+// throws away every uncommitted change after a failed update, and returns
+// `err`
+func (v *Vault) rollback(err error) error {
+	if discardErr := v.git.DiscardChanges(); discardErr != nil {
+		debug("unable to discard changes: %s", discardErr)
+		return err
+	}
+
+	if reloadErr := v.reload(); reloadErr != nil {
+		debug("unable to reload vault: %s", reloadErr)
+	}
+	return err
+}
+
 func (v *Vault) Save(commitMsg string) error {
 	return v.git.CommitAllChanges(commitMsg)
 }
 
+// commits the resolved merge left behind by `Sync`
+func (v *Vault) saveMerge(commitMsg string) error {
+	return v.git.CommitMerge(commitMsg)
+}
+
 func (v *Vault) SetRemote(remote string) error {
 	return v.git.SetRemote(remote)
 }
 
+//
+// Sync pulls and merges the remote changes, reloads the vault, and then
+// pushes the result.  A *MergeConflictError is returned if the same
+// secret was changed both locally and remotely.
+//
 func (v *Vault) Sync() error {
+	err := v.git.Pull()
+
+	if mergeErr, ok := err.(*MergeConflictError); ok && v.EncryptedNames {
+		err = v.mergeIndexConflict(mergeErr)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := v.reload(); err != nil {
+		return err
+	}
+
 	return v.git.Push()
+}
+
+// verifies every commit made since the vault's commits were signed
+func (v *Vault) verifyHistory() error {
+	return v.git.VerifyHistory(v.SignedAfter)
+}
 
-	// TODO: also pull
+func (v *Vault) newEntries() *VaultEntries {
+	entries := NewVaultEntries(v.Path, v.Name, v.EncryptedNames)
+	entries.minVersion = v.MinCipherVersion
+	return entries
+}
+
+// re-read users and entries after the working tree has changed
+func (v *Vault) reload() error {
+	v.users = NewVaultUsers(v.Path)
+	v.entries = v.newEntries()
+
+	if err := v.users.Initialize(); err != nil {
+		return err
+	}
+	return v.entries.Initialize()
 }
 
 // seed the repository
@@ -284,3 +742,12 @@ func (v *Vault) Seed() error {
 
 	return v.users.AddUser(v.credentials.Email, v.credentials.GetKeys().PublicKeyString(), masterPassphrase)
 }
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,388 @@
+package passward
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/jandre/passward/util"
+)
+
+// attachments are kept in a directory of the entry; field names can't
+// start with a dot, so it can't clash with a field.
+const attachmentsDir = ".attachments"
+
+// size of the plaintext stored in each encrypted chunk file
+const attachmentChunkSize = 1 << 20
+
+//
+// Attachment is a file stored in an entry.  Its contents are split into
+// encrypted chunks, so large files never have to fit in memory; the name,
+// mode and size are kept in an encrypted `meta` file next to them.
+//
+type Attachment struct {
+	Name   string      `json:"name"`
+	Mode   os.FileMode `json:"mode"`
+	Size   int64       `json:"size"`
+	Chunks int         `json:"chunks"`
+
+	id string
+}
+
+func (e *Entry) attachmentsPath() string {
+	return path.Join(e.path, attachmentsDir)
+}
+
+// binds a chunk, or the meta file, to the vault, entry and attachment
+func (e *Entry) attachmentAD(id string, part string) []byte {
+	return []byte(e.vault + "\x00" + e.name + "\x00" + attachmentsDir + "/" + id + "\x00" + part)
+}
+
+func chunkName(i int) string {
+	return fmt.Sprintf("%06d", i)
+}
+
+// ids of the attachments of the entry, read from disk without decrypting
+func (e *Entry) attachmentIds() ([]string, error) {
+	ids := make([]string, 0)
+	if !util.DirectoryExists(e.attachmentsPath()) {
+		return ids, nil
+	}
+
+	files, err := ioutil.ReadDir(e.attachmentsPath())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		if file.IsDir() {
+			ids = append(ids, file.Name())
+		}
+	}
+	return ids, nil
+}
+
+//
+// HasAttachments returns true if files are attached to the entry.
+//
+func (e *Entry) HasAttachments() bool {
+	ids, err := e.attachmentIds()
+	return err == nil && len(ids) > 0
+}
+
+func (e *Entry) encryptChunk(id string, part string, data []byte, encryptionKey []byte) error {
+	encrypted, err := EncryptWithAD(string(encryptionKey), data, e.attachmentAD(id, part))
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path.Join(e.attachmentsPath(), id, part), encrypted, 0600)
+}
+
+func (e *Entry) decryptChunk(id string, part string, encryptionKey []byte) ([]byte, error) {
+	encrypted, err := ioutil.ReadFile(path.Join(e.attachmentsPath(), id, part))
+	if err != nil {
+		return nil, err
+	}
+	return e.decryptChunkData(id, part, encrypted, encryptionKey)
+}
+
+// decrypts `encrypted`, the contents of the file `part` of an attachment
+func (e *Entry) decryptChunkData(id string, part string, encrypted []byte, encryptionKey []byte) ([]byte, error) {
+	data, version, err := DecryptMinVersion(string(encryptionKey), encrypted, e.attachmentAD(id, part), e.minVersion)
+	if err != nil {
+		if version == CipherVersion2 || e.minVersion != CipherVersionLegacy {
+			return nil, &TamperedError{Entry: e.name, Key: attachmentsDir + "/" + id + "/" + part}
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+func (e *Entry) readAttachment(id string, encryptionKey []byte) (*Attachment, error) {
+	encrypted, err := ioutil.ReadFile(path.Join(e.attachmentsPath(), id, "meta"))
+	if err != nil {
+		return nil, err
+	}
+	return e.decodeAttachment(id, encrypted, encryptionKey)
+}
+
+// decrypts `encrypted`, the contents of the meta file of attachment `id`
+func (e *Entry) decodeAttachment(id string, encrypted []byte, encryptionKey []byte) (*Attachment, error) {
+	data, err := e.decryptChunkData(id, "meta", encrypted, encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var attachment Attachment
+	if err := json.Unmarshal(data, &attachment); err != nil {
+		return nil, err
+	}
+	attachment.id = id
+	return &attachment, nil
+}
+
+func (e *Entry) writeAttachment(attachment *Attachment, encryptionKey []byte) error {
+	data, err := json.Marshal(attachment)
+	if err != nil {
+		return err
+	}
+	return e.encryptChunk(attachment.id, "meta", data, encryptionKey)
+}
+
+type byAttachmentName []*Attachment
+
+func (a byAttachmentName) Len() int           { return len(a) }
+func (a byAttachmentName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byAttachmentName) Less(i, j int) bool { return a[i].Name < a[j].Name }
+
+//
+// Attachments returns the files attached to the entry, sorted by name.
+//
+func (e *Entry) Attachments(encryptionKey []byte) ([]*Attachment, error) {
+	ids, err := e.attachmentIds()
+	if err != nil {
+		return nil, err
+	}
+
+	attachments := make([]*Attachment, 0, len(ids))
+	for _, id := range ids {
+		attachment, err := e.readAttachment(id, encryptionKey)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	sort.Sort(byAttachmentName(attachments))
+	return attachments, nil
+}
+
+func (e *Entry) findAttachment(name string, encryptionKey []byte) (*Attachment, error) {
+	attachments, err := e.Attachments(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, attachment := range attachments {
+		if attachment.Name == name {
+			return attachment, nil
+		}
+	}
+	return nil, nil
+}
+
+//
+// Attach encrypts everything read from `r` as the attachment `name`,
+// replacing an earlier attachment of that name.
+//
+func (e *Entry) Attach(name string, r io.Reader, mode os.FileMode, encryptionKey []byte) (*Attachment, error) {
+	previous, err := e.findAttachment(name, encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	random, err := GenRandomIv(8)
+	if err != nil {
+		return nil, err
+	}
+
+	attachment := &Attachment{Name: name, Mode: mode.Perm(), id: hex.EncodeToString(random)}
+	dir := path.Join(e.attachmentsPath(), attachment.id)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	if err := e.encryptAttachment(attachment, r, encryptionKey); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	if previous != nil {
+		if err := os.RemoveAll(path.Join(e.attachmentsPath(), previous.id)); err != nil {
+			return nil, err
+		}
+	}
+	return attachment, nil
+}
+
+// encrypts everything read from `r` into the chunks of `attachment`, then
+// writes its meta file
+func (e *Entry) encryptAttachment(attachment *Attachment, r io.Reader, encryptionKey []byte) error {
+	buf := make([]byte, attachmentChunkSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if err := e.encryptChunk(attachment.id, chunkName(attachment.Chunks), buf[:n], encryptionKey); err != nil {
+				return err
+			}
+			attachment.Chunks++
+			attachment.Size += int64(n)
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return e.writeAttachment(attachment, encryptionKey)
+}
+
+// the size of chunk `i`: every chunk is full but the last
+func (attachment *Attachment) chunkSize(i int) int64 {
+	if i < attachment.Chunks-1 {
+		return attachmentChunkSize
+	}
+	return attachment.Size - int64(attachment.Chunks-1)*attachmentChunkSize
+}
+
+// checks that the chunk count and size in the meta file add up, and that
+// every chunk is there
+func (e *Entry) checkChunks(attachment *Attachment) error {
+	tampered := &TamperedError{Entry: e.name, Key: attachmentsDir + "/" + attachment.id}
+
+	if attachment.Size < 0 || int64(attachment.Chunks) != (attachment.Size+attachmentChunkSize-1)/attachmentChunkSize {
+		return tampered
+	}
+
+	for i := 0; i < attachment.Chunks; i++ {
+		if !util.FileExists(path.Join(e.attachmentsPath(), attachment.id, chunkName(i))) {
+			return tampered
+		}
+	}
+	return nil
+}
+
+//
+// Extract decrypts the attachment `name` into `w`, one chunk at a time.
+// Missing chunks are found before anything is written, and each chunk is
+// authenticated before it is written; but a chunk that fails to decrypt is
+// only found when it is reached, after the chunks before it were written.
+//
+func (e *Entry) Extract(name string, w io.Writer, encryptionKey []byte) (*Attachment, error) {
+	attachment, err := e.findAttachment(name, encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	if attachment == nil {
+		return nil, errors.New("No attachment found: " + name + " in entry: " + e.name)
+	}
+
+	if err := e.checkChunks(attachment); err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < attachment.Chunks; i++ {
+		data, err := e.decryptChunk(attachment.id, chunkName(i), encryptionKey)
+		if err != nil {
+			return nil, err
+		}
+
+		if int64(len(data)) != attachment.chunkSize(i) {
+			return nil, &TamperedError{Entry: e.name, Key: attachmentsDir + "/" + attachment.id}
+		}
+
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	return attachment, nil
+}
+
+//
+// copies every attachment of `src`, decrypted with `oldKey`, into the entry,
+// encrypted with `newKey`.  `src` may be the entry itself, e.g. when the
+// master key is rotated.
+//
+func (e *Entry) copyAttachments(src *Entry, oldKey []byte, newKey []byte) error {
+	attachments, err := src.Attachments(oldKey)
+	if err != nil {
+		return err
+	}
+
+	for _, attachment := range attachments {
+		if err := os.MkdirAll(path.Join(e.attachmentsPath(), attachment.id), 0700); err != nil {
+			return err
+		}
+
+		for i := 0; i < attachment.Chunks; i++ {
+			data, err := src.decryptChunk(attachment.id, chunkName(i), oldKey)
+			if err != nil {
+				return err
+			}
+			if err := e.encryptChunk(attachment.id, chunkName(i), data, newKey); err != nil {
+				return err
+			}
+		}
+
+		if err := e.writeAttachment(attachment, newKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//
+// AttachFile stores everything read from `r` as the attachment `name` of the
+// entry `site`, and commits it.
+//
+func (v *Vault) AttachFile(site string, name string, r io.Reader, mode os.FileMode) (*Attachment, error) {
+	key, err := v.unlockForWrite()
+	if err != nil {
+		return nil, err
+	}
+
+	entry := v.entries.Get(site)
+	if entry == nil {
+		return nil, errors.New("No entry found: " + site)
+	}
+
+	attachment, err := entry.Attach(name, r, mode, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return attachment, v.Save(fmt.Sprintf("Attached file to entry: %s (%s)", site, name))
+}
+
+//
+// ExtractFile decrypts the attachment `name` of the entry `site` into `w`.
+//
+func (v *Vault) ExtractFile(site string, name string, w io.Writer) (*Attachment, error) {
+	key, err := v.unlockMasterKey()
+	if err != nil {
+		return nil, err
+	}
+
+	entry := v.entries.Get(site)
+	if entry == nil {
+		return nil, errors.New("No entry found: " + site)
+	}
+
+	return entry.Extract(name, w, key)
+}
+
+//
+// Attachments returns the files attached to the entry `site`.
+//
+func (v *Vault) Attachments(site string) ([]*Attachment, error) {
+	key, err := v.unlockMasterKey()
+	if err != nil {
+		return nil, err
+	}
+
+	entry := v.entries.Get(site)
+	if entry == nil {
+		return nil, errors.New("No entry found: " + site)
+	}
+
+	return entry.Attachments(key)
+}
@@ -0,0 +1,119 @@
+package passward
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestAttachExtract(t *testing.T) {
+
+	key := []byte("my master key")
+	dir, err := ioutil.TempDir("", "passward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// spans more than one chunk
+	data := bytes.Repeat([]byte{0, 1, 2, 0xff}, attachmentChunkSize/2+10)
+
+	entry := NewEntry(dir, "vault", "com.bank")
+	if _, err := entry.Attach("bundle.p12", bytes.NewReader(data), 0640, key); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	attachment, err := entry.Extract("bundle.p12", &out, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Fatal("extracted data does not match")
+	}
+	if attachment.Chunks != 3 || attachment.Mode != 0640 || attachment.Size != int64(len(data)) {
+		t.Fatal("unexpected attachment:", attachment)
+	}
+
+	other := NewEntry(dir, "vault", "com.other")
+	if err := os.MkdirAll(other.path, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(entry.attachmentsPath(), other.attachmentsPath()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Extract("bundle.p12", &out, key); err == nil {
+		t.Fatal("expected a moved attachment to fail")
+	}
+}
+
+func TestExtractMissingChunk(t *testing.T) {
+
+	key := []byte("my master key")
+	dir, err := ioutil.TempDir("", "passward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := bytes.Repeat([]byte{1}, attachmentChunkSize+10)
+
+	entry := NewEntry(dir, "vault", "com.bank")
+	attachment, err := entry.Attach("bundle.p12", bytes.NewReader(data), 0640, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Remove(path.Join(entry.attachmentsPath(), attachment.id, chunkName(1))); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if _, err := entry.Extract("bundle.p12", &out, key); err == nil {
+		t.Fatal("expected a missing chunk to fail")
+	} else if _, ok := err.(*TamperedError); !ok {
+		t.Fatal("expected *TamperedError, got:", err)
+	}
+	if out.Len() != 0 {
+		t.Fatal("expected nothing to be written, got", out.Len(), "bytes")
+	}
+}
+
+func TestAttachFailureCleansUp(t *testing.T) {
+
+	key := []byte("my master key")
+	dir, err := ioutil.TempDir("", "passward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// fails after the first chunk was written
+	failing := io.MultiReader(bytes.NewReader(make([]byte, attachmentChunkSize)), &errorReader{errors.New("read failed")})
+
+	entry := NewEntry(dir, "vault", "com.bank")
+	if _, err := entry.Attach("bundle.p12", failing, 0640, key); err == nil {
+		t.Fatal("expected a failing reader to fail")
+	}
+
+	ids, err := entry.attachmentIds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 0 {
+		t.Fatal("expected the partial attachment to be removed, found:", ids)
+	}
+}
+
+type errorReader struct {
+	err error
+}
+
+func (r *errorReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
@@ -0,0 +1,338 @@
+package passward
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+//
+// Resolution picks which side of a conflicting secret to keep.  The other
+// side is saved as a history field, so no value is lost.  Attachments have
+// no history: the other side of an attachment is dropped.
+//
+type Resolution int
+
+const (
+	KeepOurs Resolution = iota
+	KeepTheirs
+	// KeepBoth keeps ours, and saves theirs as a history field, like
+	// KeepOurs; but a side that deleted the field doesn't delete it.
+	KeepBoth
+)
+
+//
+// EntryConflict is a secret in keys/<site>/<field> that was changed both
+// locally and remotely, with both sides decrypted.
+//
+// It may be an attachment in keys/<site>/.attachments/<id> instead, whose
+// id is then set in Attachment.  Key is the attachment name, and Ours and
+// Theirs describe each side.
+//
+type EntryConflict struct {
+	Entry         string
+	Key           string
+	Attachment    string
+	Ours          string
+	Theirs        string
+	OursDeleted   bool
+	TheirsDeleted bool
+	Resolution    Resolution
+
+	// the conflicting files of an attachment
+	files []*MergeConflict
+}
+
+//
+// RevealConflicts decrypts both sides of every conflict in `mergeErr`.
+// Only conflicts under keys/ can be resolved this way; the conflicting
+// files of an attachment are returned as a single conflict.
+//
+func (v *Vault) RevealConflicts(mergeErr *MergeConflictError) ([]*EntryConflict, error) {
+	key, err := v.unlockMasterKey()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*EntryConflict, 0, len(mergeErr.Conflicts))
+	attachments := make(map[string]*EntryConflict, 0)
+
+	for _, conflict := range mergeErr.Conflicts {
+		parts := strings.Split(conflict.Path, "/")
+		isAttachment := len(parts) == 5 && parts[2] == attachmentsDir
+		if parts[0] != "keys" || (len(parts) != 3 && !isAttachment) {
+			return nil, errors.New("Unable to resolve conflict outside of keys/: " + conflict.Path)
+		}
+
+		name := parts[1]
+		if v.EncryptedNames {
+			if name = v.entries.nameForId(parts[1]); name == "" {
+				return nil, errors.New("Entry not found in index: " + parts[1])
+			}
+		}
+
+		if isAttachment {
+			ec := attachments[parts[1]+"/"+parts[3]]
+			if ec == nil {
+				ec = &EntryConflict{
+					Entry:         name,
+					Key:           parts[3],
+					Attachment:    parts[3],
+					Ours:          "(changed)",
+					Theirs:        "(changed)",
+					OursDeleted:   true,
+					TheirsDeleted: true,
+				}
+				attachments[parts[1]+"/"+parts[3]] = ec
+				result = append(result, ec)
+			}
+			if err := v.addAttachmentConflict(ec, parts[4], conflict, key); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		ec := &EntryConflict{
+			Entry:         name,
+			Key:           parts[2],
+			OursDeleted:   conflict.Ours == "",
+			TheirsDeleted: conflict.Theirs == "",
+		}
+
+		if !ec.OursDeleted {
+			if ec.Ours, err = v.revealConflictSide(ec, conflict.Ours, key); err != nil {
+				return nil, err
+			}
+		}
+
+		if !ec.TheirsDeleted {
+			if ec.Theirs, err = v.revealConflictSide(ec, conflict.Theirs, key); err != nil {
+				return nil, err
+			}
+		}
+
+		result = append(result, ec)
+	}
+
+	return result, nil
+}
+
+// decrypts one side of a conflict as if it were stored in its entry
+func (v *Vault) revealConflictSide(ec *EntryConflict, encrypted string, masterKey []byte) (string, error) {
+	entry := v.entries.newEntry(ec.Entry)
+	entry.encryptedValues[ec.Key] = encrypted
+	return entry.Reveal(ec.Key, masterKey)
+}
+
+// adds a conflicting file of an attachment to `ec`.  Each side is
+// described by its meta file, which also names the attachment.
+func (v *Vault) addAttachmentConflict(ec *EntryConflict, part string, conflict *MergeConflict, masterKey []byte) error {
+	ec.files = append(ec.files, conflict)
+	ec.OursDeleted = ec.OursDeleted && conflict.Ours == ""
+	ec.TheirsDeleted = ec.TheirsDeleted && conflict.Theirs == ""
+
+	if part != "meta" {
+		return nil
+	}
+
+	var err error
+	if conflict.Ours != "" {
+		if ec.Ours, err = v.revealAttachmentSide(ec, conflict.Ours, masterKey); err != nil {
+			return err
+		}
+	}
+	if conflict.Theirs != "" {
+		if ec.Theirs, err = v.revealAttachmentSide(ec, conflict.Theirs, masterKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decrypts one side of the meta file of an attachment conflict
+func (v *Vault) revealAttachmentSide(ec *EntryConflict, encrypted string, masterKey []byte) (string, error) {
+	entry := v.entries.newEntry(ec.Entry)
+	attachment, err := entry.decodeAttachment(ec.Attachment, []byte(encrypted), masterKey)
+	if err != nil {
+		return "", err
+	}
+	ec.Key = attachment.Name
+	return fmt.Sprintf("%s, %d bytes", attachment.Name, attachment.Size), nil
+}
+
+// true if `conflict` resolves to their side
+func (conflict *EntryConflict) keepsTheirs() bool {
+	switch conflict.Resolution {
+	case KeepTheirs:
+		return true
+	case KeepBoth:
+		return conflict.OursDeleted
+	}
+	return false
+}
+
+// the value `conflict` resolves to, and the value it loses, either of
+// which may have been deleted
+func (conflict *EntryConflict) sides() (keep string, keepDeleted bool, lose string, loseDeleted bool) {
+	ours, theirs := conflict.Ours, conflict.Theirs
+	oursDeleted, theirsDeleted := conflict.OursDeleted, conflict.TheirsDeleted
+
+	if conflict.keepsTheirs() {
+		return theirs, theirsDeleted, ours, oursDeleted
+	}
+	return ours, oursDeleted, theirs, theirsDeleted
+}
+
+// writes back the files of the side of an attachment conflict that is
+// kept, and drops the other side
+func (v *Vault) resolveAttachmentConflict(conflict *EntryConflict) error {
+	for _, file := range conflict.files {
+		contents := file.Ours
+		if conflict.keepsTheirs() {
+			contents = file.Theirs
+		}
+
+		target := path.Join(v.Path, file.Path)
+		if contents == "" {
+			if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+
+		if err := os.MkdirAll(path.Dir(target), 0700); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(target, []byte(contents), 0600); err != nil {
+			return err
+		}
+	}
+
+	// a deleted attachment leaves no empty directory behind
+	if len(conflict.files) > 0 {
+		os.Remove(path.Dir(path.Join(v.Path, conflict.files[0].Path)))
+	}
+	return nil
+}
+
+//
+// ResolveConflicts writes the chosen side of each conflict back to its
+// entry, saves the other side as a history field, and commits the merge.
+// The other side of an attachment is dropped.
+//
+func (v *Vault) ResolveConflicts(conflicts []*EntryConflict) error {
+	// pick up the cleanly merged files before rewriting the entries.
+	if err := v.reload(); err != nil {
+		return err
+	}
+
+	key, err := v.unlockMasterKey()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	names := make([]string, 0, len(conflicts))
+
+	for _, conflict := range conflicts {
+		if conflict.Attachment != "" {
+			if err := v.resolveAttachmentConflict(conflict); err != nil {
+				return err
+			}
+			names = append(names, conflict.Entry+"/"+conflict.Key)
+			continue
+		}
+
+		entry := v.entries.Get(conflict.Entry)
+		if entry == nil {
+			entry = v.entries.newEntry(conflict.Entry)
+			v.entries.entries[conflict.Entry] = entry
+		}
+
+		keep, keepDeleted, lose, loseDeleted := conflict.sides()
+
+		// the conflicted file can't be decrypted, so `Set` wouldn't record
+		// the losing side; it is recorded here instead.
+		if keepDeleted {
+			err = entry.unset(conflict.Key)
+		} else {
+			err = entry.set(conflict.Key, keep, key)
+		}
+		if err != nil {
+			return err
+		}
+
+		if !loseDeleted && (keepDeleted || lose != keep) {
+			if err := entry.addHistory(conflict.Key, lose, v.credentials.Email, now, key); err != nil {
+				return err
+			}
+		}
+
+		if err := entry.Save(); err != nil {
+			return err
+		}
+		names = append(names, conflict.Entry+"/"+conflict.Key)
+	}
+
+	if len(names) == 0 {
+		return v.saveMerge("Merge remote changes.")
+	}
+	return v.saveMerge("Resolved conflicts: " + strings.Join(names, ", "))
+}
+
+//
+// mergeIndexConflict merges a conflicting entry name index, and commits the
+// merge if nothing else conflicts.  Otherwise the remaining conflicts are
+// returned.
+//
+func (v *Vault) mergeIndexConflict(mergeErr *MergeConflictError) error {
+	var index *MergeConflict
+	remaining := make([]*MergeConflict, 0, len(mergeErr.Conflicts))
+
+	for _, conflict := range mergeErr.Conflicts {
+		if conflict.Path == "index" {
+			index = conflict
+		} else {
+			remaining = append(remaining, conflict)
+		}
+	}
+
+	if index == nil {
+		return mergeErr
+	}
+
+	// the index in the working tree is full of conflict markers, so the
+	// entries aren't unlocked: that would read it.  The sides are merged
+	// from the git index instead.
+	masterKey, err := v.unwrapMasterKey()
+	if err != nil {
+		return err
+	}
+	v.entries.indexKey = masterKey
+	v.entries.author = v.credentials.Email
+
+	if err := v.entries.mergeIndex(index.Ancestor, index.Ours, index.Theirs); err != nil {
+		debug("unable to merge index: %s", err)
+		return mergeErr
+	}
+
+	if len(remaining) > 0 {
+		mergeErr.Conflicts = remaining
+		return mergeErr
+	}
+	return v.saveMerge("Merge remote changes.")
+}
+
+//
+// AbortMerge throws away the merge left behind by a failed `Sync`.
+//
+func (v *Vault) AbortMerge() error {
+	if err := v.git.AbortMerge(); err != nil {
+		return err
+	}
+	return v.reload()
+}
@@ -0,0 +1,197 @@
+package passward
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	git2go "github.com/libgit2/git2go"
+)
+
+func TestConflictSides(t *testing.T) {
+
+	for _, test := range []struct {
+		conflict    EntryConflict
+		keep        string
+		keepDeleted bool
+		lose        string
+		loseDeleted bool
+	}{
+		{EntryConflict{Ours: "a", Theirs: "b", Resolution: KeepOurs}, "a", false, "b", false},
+		{EntryConflict{Ours: "a", Theirs: "b", Resolution: KeepTheirs}, "b", false, "a", false},
+		{EntryConflict{Ours: "a", Theirs: "b", Resolution: KeepBoth}, "a", false, "b", false},
+		{EntryConflict{OursDeleted: true, Theirs: "b", Resolution: KeepOurs}, "", true, "b", false},
+		{EntryConflict{OursDeleted: true, Theirs: "b", Resolution: KeepBoth}, "b", false, "", true},
+		{EntryConflict{Ours: "a", TheirsDeleted: true, Resolution: KeepTheirs}, "", true, "a", false},
+		{EntryConflict{Ours: "a", TheirsDeleted: true, Resolution: KeepBoth}, "a", false, "", true},
+	} {
+		keep, keepDeleted, lose, loseDeleted := test.conflict.sides()
+		if keep != test.keep || keepDeleted != test.keepDeleted || lose != test.lose || loseDeleted != test.loseDeleted {
+			t.Fatal("unexpected sides for", test.conflict, ":", keep, keepDeleted, lose, loseDeleted)
+		}
+	}
+}
+
+// creates a vault with encrypted names in `dir`/ours, pushed to a bare
+// origin, and a clone of it in `dir`/theirs
+func testSyncedVaults(t *testing.T, dir string, creds *Credentials) (*Vault, *Vault) {
+	originPath := filepath.Join(dir, "origin")
+	if _, err := git2go.InitRepository(originPath, true); err != nil {
+		t.Fatal(err)
+	}
+
+	ours, err := NewVault(filepath.Join(dir, "ours"), "vault", creds, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ours.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ours.Seed(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ours.Save("New vault created."); err != nil {
+		t.Fatal(err)
+	}
+	if err := ours.SetRemote(originPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := ours.git.Push(); err != nil {
+		t.Fatal(err)
+	}
+
+	clone := NewGit(filepath.Join(dir, "theirs", "vault"), creds, nil)
+	if err := clone.Clone(originPath); err != nil {
+		t.Fatal(err)
+	}
+	theirs, err := ReadVault(filepath.Join(dir, "theirs"), "vault", creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ours, theirs
+}
+
+func TestSyncMergesIndex(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "passward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	creds := testCredentials(t, dir, "me@example.com", "")
+	ours, theirs := testSyncedVaults(t, dir, creds)
+
+	// both sides add an entry, so both change the index
+	if err := ours.AddEntry("ours.com", "me", "secret", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := theirs.AddEntry("theirs.com", "me", "secret", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ours.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if err := theirs.Sync(); err != nil {
+		t.Fatal("expected the index to be merged, got:", err)
+	}
+	if err := ours.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, vault := range []*Vault{ours, theirs} {
+		for _, name := range []string{"ours.com", "theirs.com"} {
+			if secrets, err := vault.RevealEntry(name); err != nil {
+				t.Fatal(err)
+			} else if secrets["passphrase"] != "secret" {
+				t.Fatal("unexpected passphrase for", name, ":", secrets["passphrase"])
+			}
+		}
+	}
+
+	if merging, err := theirs.MergeInProgress(); err != nil {
+		t.Fatal(err)
+	} else if merging {
+		t.Fatal("expected the merge to be committed")
+	}
+}
+
+func TestResolveAttachmentConflict(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "passward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	creds := testCredentials(t, dir, "me@example.com", "")
+	ours, theirs := testSyncedVaults(t, dir, creds)
+
+	if err := ours.AddEntry("com.bank", "me", "secret", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ours.AttachFile("com.bank", "bundle.p12", bytes.NewReader([]byte("old")), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ours.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if err := theirs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	// ours rewrites the attachment in place, like a key rotation does,
+	// while theirs replaces it, which deletes it
+	key, err := ours.unlockMasterKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bank := ours.entries.Get("com.bank")
+	if err := bank.copyAttachments(bank, key, key); err != nil {
+		t.Fatal(err)
+	}
+	if err := ours.Save("Rewrote attachments."); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := theirs.AttachFile("com.bank", "bundle.p12", bytes.NewReader([]byte("new")), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := theirs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	err = ours.Sync()
+	mergeErr, ok := err.(*MergeConflictError)
+	if !ok {
+		t.Fatal("expected *MergeConflictError, got:", err)
+	}
+
+	conflicts, err := ours.RevealConflicts(mergeErr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conflicts) != 1 || conflicts[0].Attachment == "" || conflicts[0].Key != "bundle.p12" || !conflicts[0].TheirsDeleted {
+		t.Fatal("expected a single attachment conflict, got:", conflicts)
+	}
+
+	conflicts[0].Resolution = KeepTheirs
+	if err := ours.ResolveConflicts(conflicts); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if _, err := ours.ExtractFile("com.bank", "bundle.p12", &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "new" {
+		t.Fatal("expected their attachment, got:", out.String())
+	}
+	if attachments, err := ours.Attachments("com.bank"); err != nil {
+		t.Fatal(err)
+	} else if len(attachments) != 1 {
+		t.Fatal("expected our attachment to be dropped, got:", attachments)
+	}
+}
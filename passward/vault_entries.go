@@ -1,23 +1,81 @@
 package passward
 
 import (
+	"encoding/base64"
 	"errors"
 	"io/ioutil"
 	"os"
 	"path"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/jandre/passward/util"
 )
 
+//
+// TamperedError is returned when a secret doesn't authenticate as the
+// field it is stored in, e.g. because it was moved from another entry.
+//
+type TamperedError struct {
+	Entry string
+	Key   string
+}
+
+func (e *TamperedError) Error() string {
+	return "secret " + e.Entry + "/" + e.Key + " failed authentication; it may have been moved or tampered with"
+}
+
+var fieldNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+//
+// ValidateFieldName checks that `key` can be used as a field name, which is
+// also the name of the file the field is stored in.
+//
+func ValidateFieldName(key string) error {
+	if !fieldNamePattern.MatchString(key) {
+		return errors.New("Invalid field name (use letters, digits, '.', '_' and '-'): " + key)
+	}
+	if strings.Contains(key, historySeparator) {
+		return errors.New("Invalid field name (" + historySeparator + " is reserved for field history): " + key)
+	}
+	return nil
+}
+
+//
+// ValidateField checks the name of a field, and the value of fields that
+// have a known format.
+//
+func ValidateField(key string, val string) error {
+	if err := ValidateFieldName(key); err != nil {
+		return err
+	}
+
+	if key == TotpField {
+		if _, err := ParseTotp(val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 type Entry struct {
 	name            string
+	vault           string
 	path            string
 	encryptedValues map[string]string
+
+	// email recorded in the history of fields changed through `Set`
+	author string
+
+	// older ciphertexts are rejected, see Vault.MinCipherVersion
+	minVersion byte
 }
 
-func NewEntry(parentDir, name string) *Entry {
+func NewEntry(parentDir, vault, name string) *Entry {
 	entry := Entry{
 		name:            name,
+		vault:           vault,
 		path:            path.Join(parentDir, name),
 		encryptedValues: make(map[string]string),
 	}
@@ -25,8 +83,14 @@ func NewEntry(parentDir, name string) *Entry {
 	return &entry
 }
 
-func ReadEntry(parentDir, name string) (*Entry, error) {
-	entry := NewEntry(parentDir, name)
+func ReadEntry(parentDir, vault, name string) (*Entry, error) {
+	return readEntryDir(path.Join(parentDir, name), vault, name)
+}
+
+// reads the entry `name` stored in the directory `dir`
+func readEntryDir(dir, vault, name string) (*Entry, error) {
+	entry := NewEntry(path.Dir(dir), vault, name)
+	entry.path = dir
 	files, err := ioutil.ReadDir(entry.path)
 
 	if err != nil {
@@ -34,6 +98,11 @@ func ReadEntry(parentDir, name string) (*Entry, error) {
 	}
 
 	for _, file := range files {
+		if file.IsDir() {
+			// attachments, see vault_attachments.go
+			continue
+		}
+
 		filename := file.Name()
 		bytes, err := ioutil.ReadFile(path.Join(entry.path, filename))
 		if err != nil {
@@ -50,9 +119,33 @@ func (e *Entry) Name() string {
 	return e.name
 }
 
+// binds a ciphertext to the vault, entry and field it is stored in
+func (e *Entry) associatedData(key string) []byte {
+	return []byte(e.vault + "\x00" + e.name + "\x00" + key)
+}
+
+//
+// Set encrypts `val` into the field `key`.  A previous value that differs is
+// kept as a history record, see `History`.
+//
 func (e *Entry) Set(key string, val string, encryptionKey []byte) error {
+	if !IsHistoryKey(key) && e.encryptedValues[key] != "" {
+		// a value that can't be decrypted with `encryptionKey` (e.g. during
+		// a key rotation or a conflicted merge) is not recorded.
+		if old, err := e.Reveal(key, encryptionKey); err == nil && old != val {
+			if err := e.addHistory(key, old, e.author, time.Now(), encryptionKey); err != nil {
+				return err
+			}
+		}
+	}
+
+	return e.set(key, val, encryptionKey)
+}
+
+// encrypts `val` into the field `key`, without recording history
+func (e *Entry) set(key string, val string, encryptionKey []byte) error {
 	cryptKey := string(encryptionKey)
-	encryptedVal, err := EncryptAndBase64String(cryptKey, val)
+	encryptedVal, err := EncryptAndBase64StringWithAD(cryptKey, val, e.associatedData(key))
 	if err != nil {
 		return err
 	}
@@ -61,6 +154,29 @@ func (e *Entry) Set(key string, val string, encryptionKey []byte) error {
 	return nil
 }
 
+// removes the field `key`, including its file
+func (e *Entry) unset(key string) error {
+	delete(e.encryptedValues, key)
+
+	file := path.Join(e.path, key)
+	if util.FileExists(file) {
+		return os.Remove(file)
+	}
+	return nil
+}
+
+// name of the field that keeps an older value of `key` around
+func historyKey(key string, when time.Time) string {
+	return key + historySeparator + when.UTC().Format(historyTimeFormat)
+}
+
+//
+// IsHistoryKey returns true if `key` holds an older value of another field.
+//
+func IsHistoryKey(key string) bool {
+	return strings.Contains(key, historySeparator)
+}
+
 func (e *Entry) RevealAll(encryptionKey []byte) (map[string]string, error) {
 	result := make(map[string]string, 0)
 	for k, _ := range e.encryptedValues {
@@ -74,11 +190,52 @@ func (e *Entry) RevealAll(encryptionKey []byte) (map[string]string, error) {
 }
 
 func (e *Entry) Reveal(key string, encryptionKey []byte) (string, error) {
+	val, _, err := e.decrypt(key, encryptionKey)
+	return val, err
+}
+
+// decrypts the field `key` and returns the cipher version it was stored in
+func (e *Entry) decrypt(key string, encryptionKey []byte) (string, byte, error) {
 	encryptedVal := e.encryptedValues[key]
 	if encryptedVal == "" {
-		return "", errors.New("No val found: " + e.Name() + " for: " + key)
+		return "", CipherVersionLegacy, errors.New("No val found: " + e.Name() + " for: " + key)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encryptedVal)
+	if err != nil {
+		return "", CipherVersionLegacy, err
+	}
+
+	bytes, version, err := DecryptMinVersion(string(encryptionKey), data, e.associatedData(key), e.minVersion)
+	if err != nil {
+		if version == CipherVersion2 || e.minVersion != CipherVersionLegacy {
+			return "", version, &TamperedError{Entry: e.name, Key: key}
+		}
+		return "", version, err
 	}
-	return DecryptBase64String(string(encryptionKey), encryptedVal)
+	return string(bytes), version, nil
+}
+
+// re-encrypts every field not stored in the current cipher version, and
+// returns how many fields were rewritten.
+func (e *Entry) upgrade(encryptionKey []byte) (int, error) {
+	count := 0
+	for key := range e.encryptedValues {
+		val, version, err := e.decrypt(key, encryptionKey)
+		if err != nil {
+			return count, err
+		}
+
+		if version == CurrentCipherVersion {
+			continue
+		}
+
+		if err := e.set(key, val, encryptionKey); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
 }
 
 func (e *Entry) Save() error {
@@ -97,13 +254,29 @@ func (e *Entry) Save() error {
 
 type VaultEntries struct {
 	entries map[string]*Entry
+	vault   string
 	path    string
+
+	// with encrypted names, entries are stored in keys/<id> and the real
+	// names are kept in an encrypted index; see vault_index.go
+	encryptNames bool
+	ids          map[string]string
+	indexKey     []byte
+
+	// email of the user making changes, recorded in entry history
+	author string
+
+	// older ciphertexts are rejected, see Vault.MinCipherVersion
+	minVersion byte
 }
 
-func NewVaultEntries(parentDir string) *VaultEntries {
+func NewVaultEntries(parentDir string, vault string, encryptNames bool) *VaultEntries {
 	ve := VaultEntries{
-		entries: make(map[string]*Entry, 0),
-		path:    path.Join(parentDir, "keys"),
+		entries:      make(map[string]*Entry, 0),
+		vault:        vault,
+		path:         path.Join(parentDir, "keys"),
+		encryptNames: encryptNames,
+		ids:          make(map[string]string, 0),
 	}
 	return &ve
 }
@@ -122,18 +295,43 @@ func (ve *VaultEntries) Initialize() error {
 		}
 	}
 
+	if ve.isLocked() {
+		// entry names can't be read until `Unlock` is called.
+		return nil
+	}
+
+	names := make(map[string]string, 0)
+	if ve.encryptNames {
+		ids, err := ve.readIndex()
+		if err != nil {
+			return err
+		}
+		ve.ids = ids
+		for name, id := range ids {
+			names[id] = name
+		}
+	}
+
 	files, err := ioutil.ReadDir(ve.path)
 	if err != nil {
 		return err
 	}
 	for _, file := range files {
 		if file.Name() != ".placeholder" {
-			entry, err := ReadEntry(ve.Path(), file.Name())
+			name := file.Name()
+			if ve.encryptNames {
+				if name = names[file.Name()]; name == "" {
+					return errors.New("Entry not found in index: " + file.Name())
+				}
+			}
+
+			entry, err := readEntryDir(path.Join(ve.Path(), file.Name()), ve.vault, name)
 
 			if err != nil {
 				debug("unable to load entry", err)
 				return err
 			}
+			entry.minVersion = ve.minVersion
 
 			ve.entries[entry.Name()] = entry
 		}
@@ -143,15 +341,107 @@ func (ve *VaultEntries) Initialize() error {
 }
 
 func (ve *VaultEntries) Add(name string, key string, val string, encryptionKey []byte) error {
+	entry, err := ve.getOrCreate(name)
+	if err != nil {
+		return err
+	}
+
+	return entry.Set(key, val, encryptionKey)
+}
+
+// returns the entry `name`, creating an empty one if needed
+func (ve *VaultEntries) getOrCreate(name string) (*Entry, error) {
 	if ve.entries[name] == nil {
-		ve.entries[name] = NewEntry(ve.Path(), name)
+		if ve.encryptNames && ve.ids[name] == "" {
+			if err := ve.assignId(name); err != nil {
+				return nil, err
+			}
+		}
+		ve.entries[name] = ve.newEntry(name)
 	}
 
-	return ve.entries[name].Set(key, val, encryptionKey)
+	return ve.Get(name), nil
+}
+
+func (ve *VaultEntries) newEntry(name string) *Entry {
+	entry := NewEntry(ve.Path(), ve.vault, name)
+	entry.minVersion = ve.minVersion
+	if id := ve.ids[name]; ve.encryptNames && id != "" {
+		entry.path = path.Join(ve.Path(), id)
+	}
+	return entry
 }
 
 func (ve *VaultEntries) Get(name string) *Entry {
-	return ve.entries[name]
+	entry := ve.entries[name]
+	if entry != nil {
+		entry.author = ve.author
+	}
+	return entry
+}
+
+// deletes the entry `name` and its directory
+func (ve *VaultEntries) Remove(name string) error {
+	entry := ve.entries[name]
+	if entry == nil {
+		return errors.New("No entry found: " + name)
+	}
+
+	if err := os.RemoveAll(entry.path); err != nil {
+		return err
+	}
+
+	delete(ve.entries, name)
+	delete(ve.ids, name)
+	return nil
+}
+
+//
+// Rename moves the entry `name` to `newName`.  Every value and attachment is
+// re-encrypted, since the entry name is part of their associated data.
+//
+func (ve *VaultEntries) Rename(name string, newName string, encryptionKey []byte) error {
+	entry := ve.entries[name]
+	if entry == nil {
+		return errors.New("No entry found: " + name)
+	}
+	if ve.entries[newName] != nil {
+		return errors.New("Entry already exists: " + newName)
+	}
+
+	values, err := entry.RevealAll(encryptionKey)
+	if err != nil {
+		return err
+	}
+
+	if ve.encryptNames {
+		// keep the directory, so that the index of a rename made on both
+		// sides of a sync merges cleanly
+		ve.ids[newName] = ve.ids[name]
+	}
+
+	renamed, err := ve.getOrCreate(newName)
+	if err != nil {
+		return err
+	}
+
+	for key, val := range values {
+		if err := renamed.Set(key, val, encryptionKey); err != nil {
+			return err
+		}
+	}
+
+	if err := renamed.copyAttachments(entry, encryptionKey, encryptionKey); err != nil {
+		return err
+	}
+
+	if renamed.path == entry.path {
+		// every value was rewritten in place
+		delete(ve.entries, name)
+		delete(ve.ids, name)
+		return nil
+	}
+	return ve.Remove(name)
 }
 
 func (ve *VaultEntries) Save() error {
@@ -161,5 +451,34 @@ func (ve *VaultEntries) Save() error {
 			return err
 		}
 	}
+
+	if ve.encryptNames {
+		return ve.writeIndex()
+	}
 	return nil
 }
+
+// re-encrypts every entry from `oldKey` to `newKey` and saves them.
+func (ve *VaultEntries) reencrypt(oldKey []byte, newKey []byte) error {
+	for _, entry := range ve.entries {
+		values, err := entry.RevealAll(oldKey)
+		if err != nil {
+			return err
+		}
+
+		for key, val := range values {
+			if err := entry.set(key, val, newKey); err != nil {
+				return err
+			}
+		}
+
+		if err := entry.copyAttachments(entry, oldKey, newKey); err != nil {
+			return err
+		}
+	}
+
+	if ve.encryptNames {
+		ve.indexKey = newKey
+	}
+	return ve.Save()
+}
@@ -0,0 +1,166 @@
+package passward
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestEntrySwapIsTampering(t *testing.T) {
+
+	key := []byte("my master key")
+
+	bank := NewEntry("keys", "vault", "com.bank")
+	if err := bank.Set("passphrase", "secret", key); err != nil {
+		t.Fatal(err)
+	}
+
+	val, err := bank.Reveal("passphrase", key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if val != "secret" {
+		t.Fatal("mismatch:", val, "secret")
+	}
+
+	other := NewEntry("keys", "vault", "com.other")
+	other.encryptedValues["passphrase"] = bank.encryptedValues["passphrase"]
+
+	if _, err := other.Reveal("passphrase", key); err == nil {
+		t.Fatal("expected swapped secret to fail")
+	} else if _, ok := err.(*TamperedError); !ok {
+		t.Fatal("expected *TamperedError, got:", err)
+	}
+}
+
+func TestUpgradedEntryRejectsOlderVersions(t *testing.T) {
+
+	key := []byte("my master key")
+
+	// version 1 has the same layout as version 2, without associated data
+	v1, err := Encrypt(string(key), []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1[0] = CipherVersion1
+
+	bank := NewEntry("keys", "vault", "com.bank")
+	bank.encryptedValues["passphrase"] = base64.StdEncoding.EncodeToString(v1)
+
+	// a secret without associated data opens anywhere, until the vault
+	// has been upgraded.
+	if _, err := bank.Reveal("passphrase", key); err != nil {
+		t.Fatal(err)
+	}
+
+	bank.minVersion = CipherVersion2
+	if err := bank.Set("username", "me", key); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := bank.Reveal("username", key); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := bank.Reveal("passphrase", key); err == nil {
+		t.Fatal("expected an older ciphertext to fail")
+	} else if _, ok := err.(*TamperedError); !ok {
+		t.Fatal("expected *TamperedError, got:", err)
+	}
+}
+
+func TestRenameReencrypts(t *testing.T) {
+
+	key := []byte("my master key")
+
+	for _, encryptNames := range []bool{false, true} {
+		dir, err := ioutil.TempDir("", "passward")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		entries := NewVaultEntries(dir, "vault", encryptNames)
+		if err := entries.Unlock(key); err != nil {
+			t.Fatal(err)
+		}
+		if err := entries.Add("com.old", "passphrase", "secret", key); err != nil {
+			t.Fatal(err)
+		}
+		if err := entries.Save(); err != nil {
+			t.Fatal(err)
+		}
+		id := entries.ids["com.old"]
+
+		if err := entries.Rename("com.old", "com.new", key); err != nil {
+			t.Fatal(err)
+		}
+
+		if entries.Get("com.old") != nil {
+			t.Fatal("expected old entry to be gone")
+		}
+
+		if encryptNames && entries.ids["com.new"] != id {
+			t.Fatal("expected the renamed entry to keep its directory")
+		}
+
+		val, err := entries.Get("com.new").Reveal("passphrase", key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if val != "secret" {
+			t.Fatal("mismatch:", val, "secret")
+		}
+	}
+}
+
+func TestSetKeepsHistory(t *testing.T) {
+
+	key := []byte("my master key")
+
+	entry := NewEntry("keys", "vault", "com.bank")
+	entry.author = "bob@foo.com"
+
+	for _, val := range []string{"first", "second", "second"} {
+		if err := entry.Set("passphrase", val, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := entry.History(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 1 {
+		t.Fatal("expected 1 history record, got:", len(records))
+	}
+
+	record := records[0]
+	if record.Field != "passphrase" || record.Value != "first" || record.Author != "bob@foo.com" {
+		t.Fatal("unexpected history record:", record)
+	}
+}
+
+func TestValidateFieldName(t *testing.T) {
+
+	for _, key := range []string{"passphrase", "user.name", "api-key_2", "notes.history"} {
+		if err := ValidateFieldName(key); err != nil {
+			t.Fatal("expected", key, "to be valid:", err)
+		}
+	}
+
+	for _, key := range []string{"", ".hidden", "a/b", "a b", "passphrase.history.20200101T000000Z", "a.history.b"} {
+		if err := ValidateFieldName(key); err == nil {
+			t.Fatal("expected", key, "to be invalid")
+		}
+	}
+
+	if err := ValidateFieldName(historyKey("passphrase", time.Now())); err == nil {
+		t.Fatal("expected a history key to be rejected")
+	}
+}
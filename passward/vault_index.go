@@ -0,0 +1,186 @@
+package passward
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path"
+
+	"github.com/jandre/passward/util"
+)
+
+//
+// Vaults with encrypted names store each entry in keys/<id>, where <id>
+// is random.  The real names are kept in <vault>/index, a JSON map of
+// name to id encrypted with the master key.
+//
+
+const idSize = 16
+
+func (ve *VaultEntries) indexPath() string {
+	return path.Join(path.Dir(ve.path), "index")
+}
+
+func (ve *VaultEntries) indexAssociatedData() []byte {
+	return []byte(ve.vault + "\x00index")
+}
+
+// true if entry names are encrypted and the index hasn't been unlocked
+func (ve *VaultEntries) isLocked() bool {
+	return ve.encryptNames && ve.indexKey == nil
+}
+
+//
+// Unlock decrypts the index with the vault master key and loads the
+// entries.  It does nothing unless the vault encrypts names.
+//
+func (ve *VaultEntries) Unlock(masterKey []byte) error {
+	if !ve.isLocked() {
+		return nil
+	}
+
+	ve.indexKey = masterKey
+	ve.entries = make(map[string]*Entry, 0)
+	return ve.Initialize()
+}
+
+func (ve *VaultEntries) assignId(name string) error {
+	bytes, err := GenRandomIv(idSize)
+	if err != nil {
+		return err
+	}
+	ve.ids[name] = hex.EncodeToString(bytes)
+	return nil
+}
+
+// returns the entry name stored in directory `id`, or ""
+func (ve *VaultEntries) nameForId(id string) string {
+	for name, curr := range ve.ids {
+		if curr == id {
+			return name
+		}
+	}
+	return ""
+}
+
+func (ve *VaultEntries) decodeIndex(encrypted string) (map[string]string, error) {
+	ids := make(map[string]string, 0)
+
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, _, err := DecryptMinVersion(string(ve.indexKey), data, ve.indexAssociatedData(), ve.minVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(plaintext, &ids); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (ve *VaultEntries) encodeIndex(ids map[string]string) (string, error) {
+	plaintext, err := json.Marshal(ids)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := EncryptWithAD(string(ve.indexKey), plaintext, ve.indexAssociatedData())
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+func (ve *VaultEntries) readIndex() (map[string]string, error) {
+	if !util.FileExists(ve.indexPath()) {
+		return make(map[string]string, 0), nil
+	}
+
+	bytes, err := ioutil.ReadFile(ve.indexPath())
+	if err != nil {
+		return nil, err
+	}
+	return ve.decodeIndex(string(bytes))
+}
+
+func (ve *VaultEntries) writeIndex() error {
+	if ve.isLocked() {
+		return errors.New("Unable to save index, the entries have not been unlocked")
+	}
+
+	encoded, err := ve.encodeIndex(ve.ids)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(ve.indexPath(), []byte(encoded), 0600)
+}
+
+//
+// mergeIndex merges both sides of a conflicting index against their common
+// `ancestor`, and writes the result.  A name removed or renamed on one side
+// stays removed; it fails if both sides changed the same name differently.
+//
+func (ve *VaultEntries) mergeIndex(ancestor string, ours string, theirs string) error {
+	sides := make([]map[string]string, 3)
+
+	for i, side := range []string{ancestor, ours, theirs} {
+		sides[i] = make(map[string]string, 0)
+		if side == "" {
+			continue
+		}
+
+		ids, err := ve.decodeIndex(side)
+		if err != nil {
+			return err
+		}
+		sides[i] = ids
+	}
+
+	base, ourIds, theirIds := sides[0], sides[1], sides[2]
+	merged := make(map[string]string, 0)
+	names := make(map[string]string, 0)
+
+	for _, ids := range sides {
+		for name := range ids {
+			id, err := mergeIndexName(name, base[name], ourIds[name], theirIds[name])
+			if err != nil {
+				return err
+			}
+			if id == "" {
+				continue
+			}
+
+			// e.g. the same entry was renamed differently on both sides
+			if other, ok := names[id]; ok && other != name {
+				return errors.New("Entry was renamed both locally and remotely: " + other + ", " + name)
+			}
+			names[id] = name
+			merged[name] = id
+		}
+	}
+
+	ve.ids = merged
+	return ve.writeIndex()
+}
+
+// three-way merge of the directory of one entry name, where "" means the
+// name doesn't exist on that side
+func mergeIndexName(name string, base string, ours string, theirs string) (string, error) {
+	switch {
+	case ours == theirs:
+		return ours, nil
+	case ours == base:
+		return theirs, nil
+	case theirs == base:
+		return ours, nil
+	case base == "":
+		return "", errors.New("Entry was added both locally and remotely: " + name)
+	}
+	return "", errors.New("Entry was changed both locally and remotely: " + name)
+}
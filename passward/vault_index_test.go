@@ -0,0 +1,57 @@
+package passward
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestMergeIndex(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "passward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	entries := NewVaultEntries(dir, "vault", true)
+	if err := entries.Unlock([]byte("my master key")); err != nil {
+		t.Fatal(err)
+	}
+
+	encode := func(ids map[string]string) string {
+		encoded, err := entries.encodeIndex(ids)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return encoded
+	}
+
+	ancestor := encode(map[string]string{"a": "1", "b": "2", "c": "3"})
+
+	// ours removed a; both renamed b to b2; theirs added d
+	ours := encode(map[string]string{"b2": "2", "c": "3"})
+	theirs := encode(map[string]string{"a": "1", "b2": "2", "c": "3", "d": "4"})
+
+	if err := entries.mergeIndex(ancestor, ours, theirs); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{"b2": "2", "c": "3", "d": "4"}
+	if !reflect.DeepEqual(entries.ids, expected) {
+		t.Fatal("unexpected merge:", entries.ids)
+	}
+
+	renamedOurs := encode(map[string]string{"x": "2", "a": "1", "c": "3"})
+	renamedTheirs := encode(map[string]string{"y": "2", "a": "1", "c": "3"})
+	if err := entries.mergeIndex(ancestor, renamedOurs, renamedTheirs); err == nil {
+		t.Fatal("expected renames to different names to conflict")
+	}
+
+	addedOurs := encode(map[string]string{"a": "1", "b": "2", "c": "3", "d": "4"})
+	addedTheirs := encode(map[string]string{"a": "1", "b": "2", "c": "3", "d": "5"})
+	if err := entries.mergeIndex(ancestor, addedOurs, addedTheirs); err == nil {
+		t.Fatal("expected the same name added twice to conflict")
+	}
+}
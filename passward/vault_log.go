@@ -0,0 +1,178 @@
+package passward
+
+import (
+	"strings"
+	"time"
+)
+
+//
+// Audit event actions.
+//
+const (
+	ActionEntryAdded        = "entry.added"
+	ActionEntryChanged      = "entry.changed"
+	ActionEntryRemoved      = "entry.removed"
+	ActionAttachmentAdded   = "attachment.added"
+	ActionAttachmentChanged = "attachment.changed"
+	ActionAttachmentRemoved = "attachment.removed"
+	ActionUserAdded         = "user.added"
+	ActionUserRemoved       = "user.removed"
+	ActionMerge             = "merge"
+	ActionCommit            = "commit"
+)
+
+//
+// AuditEvent describes who changed an entry or a user of the vault.
+// Signature is one of the Signature* constants.  Events of a merge commit
+// list what the merge brought in.
+//
+type AuditEvent struct {
+	Commit    string    `json:"commit"`
+	Time      time.Time `json:"time"`
+	Author    string    `json:"author"`
+	Email     string    `json:"email"`
+	Signature string    `json:"signature"`
+	Merge     bool      `json:"merge,omitempty"`
+	Action    string    `json:"action"`
+	Site      string    `json:"site,omitempty"`
+	User      string    `json:"user,omitempty"`
+	Fields    []string  `json:"fields,omitempty"`
+	Message   string    `json:"message"`
+}
+
+//
+// LogFilter limits the events returned by `Vault.Log`.  Empty fields
+// match everything.
+//
+type LogFilter struct {
+	Site  string
+	User  string
+	Since time.Time
+}
+
+func (f *LogFilter) matches(event *AuditEvent) bool {
+	if f.Site != "" && event.Site != f.Site {
+		return false
+	}
+	if f.User != "" && event.Email != f.User && event.User != f.User {
+		return false
+	}
+	return true
+}
+
+//
+// Log returns the audit trail of the vault, newest first.
+//
+func (v *Vault) Log(filter LogFilter) ([]*AuditEvent, error) {
+	if v.EncryptedNames {
+		if _, err := v.unlockMasterKey(); err != nil {
+			return nil, err
+		}
+	}
+
+	entries, err := v.git.Log(filter.Since)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*AuditEvent, 0)
+	for _, entry := range entries {
+		for _, event := range v.auditEvents(entry) {
+			if filter.matches(event) {
+				result = append(result, event)
+			}
+		}
+	}
+	return result, nil
+}
+
+// site name for the directory under keys/
+func (v *Vault) siteName(dir string) string {
+	if v.EncryptedNames {
+		if name := v.entries.nameForId(dir); name != "" {
+			return name
+		}
+	}
+	return dir
+}
+
+// turns the files changed by a commit into audit events
+func (v *Vault) auditEvents(entry *LogEntry) []*AuditEvent {
+	events := make([]*AuditEvent, 0)
+	sites := make(map[string]*AuditEvent, 0)
+	attachments := make(map[string]*AuditEvent, 0)
+
+	newEvent := func(action string) *AuditEvent {
+		return &AuditEvent{
+			Commit:    entry.Commit,
+			Time:      entry.When,
+			Author:    entry.Author,
+			Email:     entry.Email,
+			Signature: entry.Signature,
+			Merge:     entry.Merge,
+			Action:    action,
+			Message:   entry.Message,
+		}
+	}
+
+	for _, change := range entry.Changes {
+		parts := strings.Split(change.Path, "/")
+
+		switch {
+		case len(parts) == 5 && parts[0] == "keys" && parts[2] == attachmentsDir:
+			// keys/<site>/.attachments/<id>/<chunk>, one event per attachment
+			site := v.siteName(parts[1])
+			id := site + "/" + parts[3]
+			event := attachments[id]
+			if event == nil {
+				event = newEvent("attachment." + change.Action)
+				event.Site = site
+				attachments[id] = event
+				events = append(events, event)
+			} else if parts[4] == "meta" {
+				// the metadata tells whether the attachment was added or removed
+				event.Action = "attachment." + change.Action
+			}
+
+		case len(parts) != 3:
+			continue
+
+		case parts[0] == "keys":
+			site := v.siteName(parts[1])
+			event := sites[site]
+			if event == nil {
+				event = newEvent(change.Action)
+				event.Site = site
+				sites[site] = event
+				events = append(events, event)
+			} else if event.Action != change.Action {
+				event.Action = "changed"
+			}
+			event.Fields = append(event.Fields, parts[2])
+
+		case parts[0] == "users" && parts[2] == "key":
+			if change.Action == "added" {
+				event := newEvent(ActionUserAdded)
+				event.User = parts[1]
+				events = append(events, event)
+			} else if change.Action == "removed" {
+				event := newEvent(ActionUserRemoved)
+				event.User = parts[1]
+				events = append(events, event)
+			}
+		}
+	}
+
+	for _, event := range sites {
+		event.Action = "entry." + event.Action
+	}
+
+	if len(events) == 0 {
+		if entry.Merge {
+			events = append(events, newEvent(ActionMerge))
+		} else {
+			events = append(events, newEvent(ActionCommit))
+		}
+	}
+	return events
+}
@@ -0,0 +1,50 @@
+package passward
+
+import (
+	"testing"
+)
+
+func TestAuditEvents(t *testing.T) {
+
+	vault := &Vault{Name: "test"}
+	entry := &LogEntry{
+		Commit: "1234",
+		Email:  "alice@example.com",
+		Changes: []*FileChange{
+			{Path: "keys/com.bank/username", Action: "added"},
+			{Path: "keys/com.bank/passphrase", Action: "added"},
+			{Path: "keys/com.mail/passphrase", Action: "changed"},
+			{Path: "users/bob@example.com/key", Action: "added"},
+			{Path: "users/bob@example.com/encrypted_master", Action: "added"},
+			{Path: "keys/com.mail/.attachments/abcd/000000000", Action: "added"},
+			{Path: "keys/com.mail/.attachments/abcd/meta", Action: "added"},
+		},
+	}
+
+	events := vault.auditEvents(entry)
+
+	if len(events) != 4 {
+		t.Fatal("expected 4 events, got:", len(events))
+	}
+
+	if events[0].Action != ActionEntryAdded || events[0].Site != "com.bank" || len(events[0].Fields) != 2 {
+		t.Fatal("unexpected event:", events[0])
+	}
+
+	if events[1].Action != ActionEntryChanged || events[1].Site != "com.mail" {
+		t.Fatal("unexpected event:", events[1])
+	}
+
+	if events[2].Action != ActionUserAdded || events[2].User != "bob@example.com" {
+		t.Fatal("unexpected event:", events[2])
+	}
+
+	if events[3].Action != ActionAttachmentAdded || events[3].Site != "com.mail" {
+		t.Fatal("unexpected event:", events[3])
+	}
+
+	filter := LogFilter{Site: "com.mail"}
+	if filter.matches(events[0]) || !filter.matches(events[1]) {
+		t.Fatal("site filter mismatch")
+	}
+}
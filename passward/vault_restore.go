@@ -0,0 +1,255 @@
+package passward
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+//
+// LookupRevision finds the vault commit named by `spec`.
+//
+func (v *Vault) LookupRevision(spec string) (*Revision, error) {
+	return v.git.LookupRevision(spec)
+}
+
+//
+// RevisionAt finds the newest vault commit made at or before `when`.
+//
+func (v *Vault) RevisionAt(when time.Time) (*Revision, error) {
+	return v.git.RevisionAt(when)
+}
+
+// the master key as of `rev`, which differs from the current one if it has
+// been rotated since.
+func (v *Vault) masterKeyAt(rev *Revision) ([]byte, error) {
+	userPath := path.Join("users", v.credentials.Email)
+	keys := v.credentials.GetKeys()
+
+	if keys.FromSshAgent() {
+		return v.masterKeyAtWithSshAgent(rev, userPath)
+	}
+
+	encrypted, err := v.git.ReadFileAt(rev, path.Join(userPath, "encrypted_master"))
+	if err != nil {
+		if IsNotFound(err) {
+			return nil, errors.New("You were not a user of the vault at revision " + rev.ShortId())
+		}
+		return nil, err
+	}
+	return keys.DecryptBase64(encrypted)
+}
+
+// the master key as of `rev`, unwrapped through ssh-agent
+func (v *Vault) masterKeyAtWithSshAgent(rev *Revision, userPath string) ([]byte, error) {
+	challenge, err := v.git.ReadFileAt(rev, path.Join(userPath, "agent_challenge"))
+	if err == nil {
+		var wrapped string
+		if wrapped, err = v.git.ReadFileAt(rev, path.Join(userPath, "agent_master")); err == nil {
+			user := v.users.LookupByEmail(v.credentials.Email)
+			return user.unwrapWithSshAgent(v.credentials.GetKeys().signer, challenge, wrapped)
+		}
+	}
+
+	if IsNotFound(err) {
+		return nil, errors.New("ssh-agent unlock was not set up at revision " + rev.ShortId() + "; unlock with your private key file instead")
+	}
+	return nil, err
+}
+
+// the oldest cipher version the vault accepted at `rev`.  Secrets of the
+// time are held to it, not to the minimum of a later upgrade.
+func (v *Vault) minCipherVersionAt(rev *Revision) (byte, error) {
+	config, err := v.git.ReadFileAt(rev, "config.toml")
+	if err != nil {
+		if IsNotFound(err) {
+			return CipherVersionLegacy, nil
+		}
+		return 0, err
+	}
+
+	var old Vault
+	if _, err := toml.Decode(config, &old); err != nil {
+		return 0, err
+	}
+	return old.MinCipherVersion, nil
+}
+
+// maps each entry name at `rev` to its directory under keys/
+func (v *Vault) entryDirsAt(rev *Revision, oldKey []byte, minVersion byte) (map[string]string, error) {
+	dirs := make(map[string]string, 0)
+
+	names, err := v.git.ListDirAt(rev, "keys")
+	if err != nil {
+		if IsNotFound(err) {
+			return dirs, nil
+		}
+		return nil, err
+	}
+
+	byId := make(map[string]string, 0)
+	if v.EncryptedNames {
+		encoded, err := v.git.ReadFileAt(rev, "index")
+		if err != nil && !IsNotFound(err) {
+			return nil, err
+		}
+
+		if err == nil {
+			old := NewVaultEntries(v.Path, v.Name, true)
+			old.indexKey = oldKey
+			old.minVersion = minVersion
+			ids, err := old.decodeIndex(encoded)
+			if err != nil {
+				return nil, err
+			}
+			for name, id := range ids {
+				byId[id] = name
+			}
+		}
+	}
+
+	for _, dir := range names {
+		if dir == ".placeholder" {
+			continue
+		}
+
+		name := dir
+		if v.EncryptedNames {
+			if name = byId[dir]; name == "" {
+				continue
+			}
+		}
+		dirs[name] = dir
+	}
+	return dirs, nil
+}
+
+// rewrites entry `name` with its fields as of `rev`, which are decrypted
+// with `oldKey` and the `minVersion` of the time
+func (v *Vault) restoreEntry(rev *Revision, name string, dir string, oldKey []byte, minVersion byte, newKey []byte) error {
+	fields, err := v.git.ListDirAt(rev, path.Join("keys", dir))
+	if err != nil {
+		return err
+	}
+
+	old := v.entries.newEntry(name)
+	old.minVersion = minVersion
+	for _, field := range fields {
+		if field == attachmentsDir {
+			// attachments are left as they are
+			continue
+		}
+
+		encrypted, err := v.git.ReadFileAt(rev, path.Join("keys", dir, field))
+		if err != nil {
+			return err
+		}
+		old.encryptedValues[field] = encrypted
+	}
+
+	values, err := old.RevealAll(oldKey)
+	if err != nil {
+		return err
+	}
+
+	for field, val := range values {
+		if err := v.entries.Add(name, field, val, newKey); err != nil {
+			return err
+		}
+	}
+
+	// drop fields that were added after `rev`, but keep their history
+	entry := v.entries.Get(name)
+	for field := range entry.encryptedValues {
+		if _, ok := values[field]; !ok && !IsHistoryKey(field) {
+			if err := entry.unset(field); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//
+// RestoreEntry restores the entry `name` to how it was at `rev`, and
+// commits the result.  It is decrypted with the master key of the time.
+//
+func (v *Vault) RestoreEntry(name string, rev *Revision) error {
+	newKey, err := v.unlockForWrite()
+	if err != nil {
+		return err
+	}
+
+	oldKey, err := v.masterKeyAt(rev)
+	if err != nil {
+		return err
+	}
+
+	minVersion, err := v.minCipherVersionAt(rev)
+	if err != nil {
+		return err
+	}
+
+	dirs, err := v.entryDirsAt(rev, oldKey, minVersion)
+	if err != nil {
+		return err
+	}
+
+	dir, ok := dirs[name]
+	if !ok {
+		return errors.New("No entry found: " + name + " at revision " + rev.ShortId())
+	}
+
+	if err := v.restoreEntry(rev, name, dir, oldKey, minVersion, newKey); err != nil {
+		return err
+	}
+
+	if err := v.entries.Save(); err != nil {
+		return err
+	}
+	return v.Save(fmt.Sprintf("Restored entry: %s from revision %s.", name, rev.ShortId()))
+}
+
+//
+// RestoreAll restores every entry that existed at `rev`, and returns how
+// many were restored.  Entries created after `rev` are kept, and users are
+// not restored.
+//
+func (v *Vault) RestoreAll(rev *Revision) (int, error) {
+	newKey, err := v.unlockForWrite()
+	if err != nil {
+		return 0, err
+	}
+
+	oldKey, err := v.masterKeyAt(rev)
+	if err != nil {
+		return 0, err
+	}
+
+	minVersion, err := v.minCipherVersionAt(rev)
+	if err != nil {
+		return 0, err
+	}
+
+	dirs, err := v.entryDirsAt(rev, oldKey, minVersion)
+	if err != nil {
+		return 0, err
+	}
+
+	for name, dir := range dirs {
+		if err := v.restoreEntry(rev, name, dir, oldKey, minVersion, newKey); err != nil {
+			debug("unable to restore entry %s: %s", name, err)
+			return 0, err
+		}
+	}
+
+	if err := v.entries.Save(); err != nil {
+		return 0, err
+	}
+
+	msg := fmt.Sprintf("Restored %d entries from revision %s.", len(dirs), rev.ShortId())
+	return len(dirs), v.Save(msg)
+}
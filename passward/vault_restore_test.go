@@ -0,0 +1,90 @@
+package passward
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestRestoreAcrossUpgrade(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "passward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	creds := testCredentials(t, dir, "me@example.com", "")
+	vault, err := NewVault(dir, "vault", creds, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a vault from before version 2, which still accepts version 1
+	vault.MinCipherVersion = CipherVersionLegacy
+	vault.entries.minVersion = CipherVersionLegacy
+	if err := vault.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.Seed(); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.AddEntry("com.bank", "me", "placeholder", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := vault.unlockMasterKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// version 1 has the same layout as version 2, without associated data
+	v1, err := Encrypt(string(key), []byte("old secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1[0] = CipherVersion1
+
+	bank := vault.entries.Get("com.bank")
+	bank.encryptedValues["passphrase"] = base64.StdEncoding.EncodeToString(v1)
+	if err := bank.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.Save("Legacy secret."); err != nil {
+		t.Fatal(err)
+	}
+
+	head, err := vault.git.headId()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rev, err := vault.LookupRevision(head)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := vault.Upgrade(); err != nil {
+		t.Fatal(err)
+	}
+	if err := vault.SetFields("com.bank", map[string]string{"passphrase": "new secret"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := vault.RestoreEntry("com.bank", rev); err != nil {
+		t.Fatal("expected the pre-upgrade revision to restore, got:", err)
+	}
+
+	if secrets, err := vault.RevealEntry("com.bank"); err != nil {
+		t.Fatal(err)
+	} else if secrets["passphrase"] != "old secret" {
+		t.Fatal("unexpected passphrase:", secrets["passphrase"])
+	}
+
+	// the restored secret is stored in the current version
+	if _, version, err := vault.entries.Get("com.bank").decrypt("passphrase", key); err != nil {
+		t.Fatal(err)
+	} else if version != CurrentCipherVersion {
+		t.Fatal("unexpected version:", version)
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"path"
 
 	"github.com/jandre/passward/util"
-	"github.com/jandre/sshcrypt"
 )
 
 //
@@ -41,7 +40,7 @@ func (vu *VaultUsers) removeByEmail(email string) error {
 
 	err := user.Remove()
 
-	vu.users[email] = nil
+	delete(vu.users, email)
 
 	return err
 }
@@ -101,7 +100,11 @@ type VaultUser struct {
 	email              string
 	publicKeyString    string
 	encryptedMasterKey string
-	publicKey          sshcrypt.PublicKey
+	publicKey          sshEncrypter
+
+	// master key wrapped for ssh-agent unlock, see ssh_agent.go
+	agentChallenge string
+	agentMasterKey string
 }
 
 func (vu *VaultUser) Remove() error {
@@ -135,7 +138,7 @@ func (vu *VaultUser) Save() error {
 	if err := ioutil.WriteFile(encryptedMaster, []byte(vu.encryptedMasterKey), 0600); err != nil {
 		return err
 	}
-	return nil
+	return vu.saveSshAgent()
 }
 
 func (vu *VaultUser) encryptedMasterFile() string {
@@ -168,7 +171,7 @@ func NewVaultUser(usersPath string, email string, publicKey string) (*VaultUser,
 	user.email = email
 	user.publicKeyString = publicKey
 
-	user.publicKey, _, _, _, err = sshcrypt.ParseAuthorizedKey([]byte(publicKey))
+	user.publicKey, err = parseEncryptionKey([]byte(publicKey))
 
 	if err != nil {
 		debug("unable to parse public key:", publicKey, err)
@@ -191,7 +194,12 @@ func ReadVaultUser(pathToUser string) (*VaultUser, error) {
 	}
 
 	user.publicKeyString = string(bytes)
-	user.publicKey, _, _, _, err = sshcrypt.ParseAuthorizedKey([]byte(user.publicKeyString))
+	user.publicKey, err = parseEncryptionKey([]byte(user.publicKeyString))
+
+	if err != nil {
+		debug("unable to parse public key %s", err)
+		return nil, err
+	}
 
 	keyBytes, err := ioutil.ReadFile(user.encryptedMasterFile())
 
@@ -201,5 +209,8 @@ func ReadVaultUser(pathToUser string) (*VaultUser, error) {
 	}
 
 	user.encryptedMasterKey = string(keyBytes)
+	if err := user.readSshAgent(); err != nil {
+		return nil, err
+	}
 	return &user, nil
 }
@@ -0,0 +1,90 @@
+package passward
+
+//
+// wordList is used by `GeneratePassphrase`.  Words are short, common and
+// distinct so passphrases are easy to type.
+//
+var wordList = []string{
+	"able", "acid", "acorn", "acre", "act", "actor", "adapt", "add", "admit",
+	"adopt", "adult", "agent", "agree", "ahead", "aim", "air", "alarm", "album",
+	"alert", "alien", "alley", "allow", "alpha", "amber", "angle", "ankle",
+	"apple", "april", "apron", "arch", "arena", "arm", "army", "arrow", "art",
+	"ash", "aside", "atlas", "atom", "attic", "audio", "aunt", "autumn",
+	"avoid", "awake", "award", "axis", "baby", "bacon", "badge", "badger",
+	"bag", "bagel", "baker", "ball", "bamboo", "banana", "band", "bank", "barn",
+	"basil", "basin", "basket", "bath", "beach", "bead", "beam", "bean", "bear",
+	"beard", "beaver", "bee", "beef", "bell", "belt", "bench", "berry", "bike",
+	"bird", "bison", "blade", "blank", "blast", "blend", "blink", "block",
+	"bloom", "blue", "board", "boat", "body", "bolt", "bone", "bonus", "book",
+	"boot", "border", "boss", "bottle", "bowl", "box", "brain", "brass",
+	"bread", "brick", "bride", "brief", "broom", "brush", "bubble", "bucket",
+	"buddy", "buffalo", "bulb", "bunny", "burst", "bus", "bush", "butter",
+	"button", "cabin", "cable", "cactus", "cake", "calm", "camel", "camera",
+	"camp", "canal", "candle", "candy", "canoe", "canvas", "canyon", "cape",
+	"card", "cargo", "carpet", "carrot", "cart", "case", "cash", "castle",
+	"cat", "cave", "cedar", "cell", "chain", "chair", "chalk", "charm", "chart",
+	"cheese", "cherry", "cherub", "chess", "chest", "chicken", "chief", "chin",
+	"chip", "choir", "cider", "cigar", "cinema", "circle", "city", "clam",
+	"clay", "clerk", "cliff", "climb", "clock", "cloud", "clover", "club",
+	"coach", "coast", "coat", "cobalt", "cobra", "cocoa", "coconut", "code",
+	"coffee", "coin", "comet", "copper", "coral", "cord", "corn", "cotton",
+	"couch", "cousin", "cover", "cowboy", "crab", "craft", "crane", "crater",
+	"crayon", "cream", "creek", "crew", "cricket", "crisp", "crow", "crown",
+	"cube", "cup", "curtain", "curve", "cycle", "daisy", "dance", "dawn",
+	"deer", "delta", "denim", "desert", "desk", "diary", "dice", "dingo",
+	"dinner", "disk", "diver", "dock", "doctor", "dog", "doll", "dolphin",
+	"donkey", "door", "dot", "dove", "dragon", "drama", "dream", "dress",
+	"drill", "drum", "duck", "dune", "dust", "eagle", "earth", "easel", "echo",
+	"edge", "eel", "egg", "elbow", "elder", "elk", "elm", "ember", "emerald",
+	"engine", "epoch", "equal", "error", "essay", "event", "exit", "fabric",
+	"face", "fairy", "falcon", "family", "fan", "farm", "fawn", "feast",
+	"feather", "fence", "fern", "ferry", "fiber", "field", "fig", "film",
+	"finch", "finger", "fire", "fish", "fjord", "flag", "flame", "flask",
+	"fleet", "flint", "flock", "flood", "floor", "flour", "flower", "flute",
+	"foam", "fog", "folk", "forest", "fork", "fossil", "fox", "frame", "frog",
+	"frost", "fruit", "fudge", "gallon", "game", "garden", "garlic", "gate",
+	"gear", "gecko", "gem", "ghost", "giant", "ginger", "giraffe", "glass",
+	"globe", "glove", "glue", "goat", "gold", "golf", "goose", "gorilla",
+	"grape", "graph", "grass", "gravel", "gravy", "green", "grill", "guitar",
+	"gull", "habit", "hammer", "hamster", "harbor", "harp", "hat", "hawk",
+	"hazel", "heart", "hedge", "helmet", "hen", "herb", "heron", "hill",
+	"hinge", "hippo", "hobby", "honey", "hood", "hook", "horn", "horse",
+	"hotel", "house", "hub", "hyena", "igloo", "image", "inch", "index", "ink",
+	"input", "iron", "island", "ivory", "ivy", "jacket", "jade", "jaguar",
+	"jam", "jar", "jazz", "jeans", "jelly", "jewel", "jockey", "juice",
+	"jungle", "kayak", "kernel", "kettle", "key", "kid", "kite", "kitten",
+	"kiwi", "knee", "knife", "knot", "koala", "label", "lace", "ladder",
+	"lagoon", "lake", "lamb", "lamp", "lane", "laser", "lava", "lawn", "leaf",
+	"lemon", "lens", "letter", "lever", "lily", "lime", "linen", "lion",
+	"lizard", "llama", "lobster", "lock", "locket", "lodge", "logic", "loop",
+	"lotus", "lunar", "lunch", "lynx", "magnet", "mango", "maple", "marble",
+	"market", "mask", "meadow", "medal", "melon", "menu", "mesa", "metal",
+	"meteor", "milk", "mint", "mirror", "mitten", "model", "mole", "monkey",
+	"moon", "moose", "moss", "motor", "mouse", "mud", "mug", "mule", "museum",
+	"music", "nail", "napkin", "nectar", "needle", "nest", "net", "nickel",
+	"noodle", "north", "nose", "notch", "novel", "nugget", "nut", "oak",
+	"oasis", "ocean", "olive", "onion", "opera", "orbit", "orchid", "otter",
+	"oven", "owl", "oxygen", "oyster", "paddle", "page", "paint", "palace",
+	"palm", "panda", "panel", "paper", "parade", "parrot", "pasta", "peach",
+	"peanut", "pear", "pebble", "pelican", "pencil", "penguin", "pepper",
+	"piano", "pickle", "pigeon", "pillow", "pilot", "pine", "pirate", "pizza",
+	"planet", "plate", "plum", "pocket", "poem", "polar", "pond", "pony",
+	"poppy", "potato", "pottery", "puppy", "puzzle", "quail", "quartz", "queen",
+	"quilt", "quiver", "rabbit", "radar", "radio", "raft", "rain", "raisin",
+	"ranch", "raven", "razor", "recipe", "reef", "rhino", "ribbon", "rice",
+	"ridge", "ring", "river", "robin", "robot", "rocket", "roof", "rope",
+	"rose", "ruby", "rug", "ruler", "saddle", "sail", "salad", "salmon", "salt",
+	"sand", "sapphire", "saucer", "scarf", "school", "scout", "sea", "seal",
+	"seed", "shadow", "shark", "sheep", "shell", "shirt", "shoe", "shrimp",
+	"silk", "silver", "sketch", "skunk", "sled", "slope", "snail", "snake",
+	"sock", "sofa", "spade", "spider", "spoon", "spruce", "squid", "stable",
+	"star", "statue", "steam", "stone", "storm", "stove", "straw", "stream",
+	"sugar", "summit", "sun", "swan", "sweater", "table", "tablet", "tail",
+	"tango", "taxi", "tea", "teapot", "tent", "thistle", "thorn", "thumb",
+	"ticket", "tiger", "timber", "toast", "tomato", "tongue", "tooth", "torch",
+	"toucan", "tower", "toy", "tractor", "trail", "train", "tree", "tulip",
+	"tuna", "tunnel", "turkey", "turtle", "twig", "umbrella", "unicorn",
+	"valley", "vase", "velvet", "violin", "volcano", "wagon", "walnut",
+	"walrus", "wave", "whale", "wheat", "wheel", "whistle", "willow", "window",
+	"wolf", "wool", "yacht", "yodel", "yogurt", "zebra", "zipper",
+}